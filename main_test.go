@@ -1,10 +1,11 @@
 package main
 
 import (
+	"bytes"
+	gocontext "context"
 	"fmt"
 	dockerized "github.com/datastack-net/dockerized/pkg"
 	"github.com/stretchr/testify/assert"
-	"io/ioutil"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"os"
 	"path/filepath"
@@ -13,69 +14,87 @@ import (
 	"testing"
 )
 
-var initialEnv = os.Environ()
-
 type Context struct {
-	homePath  string
-	before    []func()
-	after     []func()
-	envBefore []string
-	cwdBefore string
+	homePath string
+	after    []func()
+	env      map[string]string
+	cwd      string
 }
 
 func TestHelp(t *testing.T) {
-	output := testDockerized(t, []string{"--help"})
+	output := testDockerized(t, newContext(), []string{"--help"})
 	assert.Contains(t, output, "Usage:")
 }
 
+func TestUnknownOption(t *testing.T) {
+	err, exitCode := RunCli([]string{"--unknown-option", "go"})
+	var unknownOptionError *dockerized.UnknownOptionError
+	assert.ErrorAs(t, err, &unknownOptionError)
+	assert.Equal(t, "--unknown-option", unknownOptionError.Option)
+	assert.Equal(t, dockerized.ExitCodeUsage, exitCode)
+}
+
 func TestEntrypoint(t *testing.T) {
 	var projectDir = dockerized.GetDockerizedRoot() + "/test/test_entrypoint"
-	defer context().
+	c := newContext().
 		WithDir(projectDir).
 		WithCwd(projectDir).
 		WithFile("foo.txt", "foo").
-		WithFile("bar.txt", "bar").
-		Restore()
+		WithFile("bar.txt", "bar")
+	defer c.Restore()
 
-	output := testDockerized(t, []string{"--entrypoint", "ls", "go"})
+	output := testDockerized(t, c, []string{"--entrypoint", "ls", "go"})
 	assert.Contains(t, output, "foo.txt")
 	assert.Contains(t, output, "bar.txt")
 }
 
+func TestMapUser(t *testing.T) {
+	var projectDir = dockerized.GetDockerizedRoot() + "/test/test_map_user"
+	c := newContext().
+		WithDir(projectDir).
+		WithCwd(projectDir)
+	defer c.Restore()
+
+	output := testDockerized(t, c, []string{"--map-user", "alpine", "sh", "-c", "id -u && echo $HOME"})
+	assert.Contains(t, output, strconv.Itoa(os.Getuid()))
+	assert.Contains(t, output, "/dockerized/home")
+}
+
 func TestOverrideVersionWithEnvVar(t *testing.T) {
-	defer context().WithEnv("PROTOC_VERSION", "3.6.0").Restore()
-	var output = testDockerized(t, []string{"protoc", "--version"})
+	c := newContext().WithEnv("PROTOC_VERSION", "3.6.0")
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"protoc", "--version"})
 	assert.Contains(t, output, "libprotoc 3.6.0")
 }
 
 func TestLocalEnvFileOverridesGlobalEnvFile(t *testing.T) {
 	var projectPath = dockerized.GetDockerizedRoot() + "/test/project_override_global"
-	defer context().
+	c := newContext().
 		WithTempHome().
 		WithHomeEnvFile("PROTOC_VERSION=3.6.0").
 		WithDir(projectPath).
 		WithCwd(projectPath).
-		WithFile(projectPath+"/dockerized.env", "PROTOC_VERSION=3.8.0").
-		Restore()
-	var output = testDockerized(t, []string{"-v", "protoc", "--version"})
+		WithFile(projectPath+"/dockerized.env", "PROTOC_VERSION=3.8.0")
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"-v", "protoc", "--version"})
 	assert.Contains(t, output, "libprotoc 3.8.0")
 }
 
 func TestRuntimeEnvOverridesLocalEnvFile(t *testing.T) {
 	var projectPath = dockerized.GetDockerizedRoot() + "/test/project_override_global"
-	defer context().
+	c := newContext().
 		WithTempHome().
 		WithDir(projectPath).
 		WithCwd(projectPath).
 		WithFile(projectPath+"/dockerized.env", "PROTOC_VERSION=3.8.0").
-		WithEnv("PROTOC_VERSION", "3.16.1").
-		Restore()
-	var output = testDockerized(t, []string{"protoc", "--version"})
+		WithEnv("PROTOC_VERSION", "3.16.1")
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"protoc", "--version"})
 	assert.Contains(t, output, "libprotoc 3.16.1")
 }
 
 func TestCustomGlobalComposeFileAdditionalService(t *testing.T) {
-	defer context().
+	c := newContext().
 		WithTempHome().
 		WithHomeEnvFile(`COMPOSE_FILE="${COMPOSE_FILE};${HOME}/docker-compose.yml"`).
 		WithHomeFile("docker-compose.yml", `
@@ -83,14 +102,14 @@ version: "3"
 services:
   test:
     image: alpine
-`).
-		Restore()
-	var output = testDockerized(t, []string{"test", "uname"})
+`)
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"test", "uname"})
 	assert.Contains(t, output, "Linux")
 }
 
 func TestUserCanGloballyCustomizeDockerizedCommands(t *testing.T) {
-	defer context().
+	c := newContext().
 		WithTempHome().
 		WithHomeEnvFile(`COMPOSE_FILE="${COMPOSE_FILE};${HOME}/docker-compose.yml"`).
 		WithHomeFile("docker-compose.yml", `
@@ -99,9 +118,9 @@ services:
   alpine:
     environment:
       CUSTOM: "CUSTOM_123456"
-`).
-		Restore()
-	var output = testDockerized(t, []string{"alpine", "env"})
+`)
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"alpine", "env"})
 	assert.Contains(t, output, "CUSTOM_123456")
 }
 
@@ -109,7 +128,7 @@ func TestUserCanLocallyCustomizeDockerizedCommands(t *testing.T) {
 	projectPath := dockerized.GetDockerizedRoot() + "/test/project_with_customized_service"
 	projectSubPath := projectPath + "/sub"
 
-	defer context().
+	c := newContext().
 		WithTempHome().
 		WithDir(projectPath).
 		WithDir(projectSubPath).
@@ -121,16 +140,46 @@ services:
   alpine:
     environment:
       CUSTOM: "CUSTOM_123456"
-`).
-		Restore()
-	var output = testDockerized(t, []string{"-v", "alpine", "env"})
+`)
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"-v", "alpine", "env"})
 	assert.Contains(t, output, "CUSTOM_123456")
 }
 
+func TestProjectRootIsAccessibleFromSubDirectory(t *testing.T) {
+	projectPath := dockerized.GetDockerizedRoot() + "/test/project_parent_access"
+	projectSubPath := projectPath + "/sub"
+
+	c := newContext().
+		WithTempHome().
+		WithDir(projectPath).
+		WithDir(projectSubPath).
+		WithCwd(projectSubPath).
+		WithFile(projectPath+"/dockerized.env", "").
+		WithFile(projectPath+"/sibling.txt", "sibling")
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"alpine", "cat", "../sibling.txt"})
+	assert.Contains(t, output, "sibling")
+}
+
+func TestTranslatePaths(t *testing.T) {
+	projectPath := dockerized.GetDockerizedRoot() + "/test/project_translate_paths"
+
+	c := newContext().
+		WithTempHome().
+		WithDir(projectPath).
+		WithCwd(projectPath).
+		WithFile(projectPath+"/dockerized.env", "").
+		WithFile(projectPath+"/foo.txt", "foo")
+	defer c.Restore()
+	var output = testDockerized(t, c, []string{"--translate-paths", "alpine", "ls", projectPath + "/foo.txt"})
+	assert.Contains(t, output, projectPath+"/foo.txt")
+}
+
 func TestUserCanIncludeGlobalAndProjectComposeFile(t *testing.T) {
 	projectPath := dockerized.GetDockerizedRoot() + "/test/project" + strconv.Itoa(rand.Int())
 
-	context := context().
+	c := newContext().
 		WithTempHome().
 		WithHomeEnvFile(`COMPOSE_FILE="${COMPOSE_FILE};${HOME}/docker-compose.dockerized.yml"`).
 		WithHomeFile("docker-compose.dockerized.yml", `
@@ -150,17 +199,17 @@ services:
     image: "alpine"
     entrypoint: [ "echo", "PROJECT123" ]
 `)
-	defer context.Restore()
-	var outputProjectCmd = testDockerized(t, []string{"-v", "project_cmd"})
+	defer c.Restore()
+	var outputProjectCmd = testDockerized(t, c, []string{"-v", "project_cmd"})
 	assert.Contains(t, outputProjectCmd, "PROJECT123")
 
-	var outputHomeCmd = testDockerized(t, []string{"-v", "home_cmd"})
+	var outputHomeCmd = testDockerized(t, c, []string{"-v", "home_cmd"})
 	assert.Contains(t, outputHomeCmd, "HOME123")
 
 }
 
 func (c *Context) WithEnv(key string, value string) *Context {
-	_ = os.Setenv(key, value)
+	c.env[key] = value
 	return c
 }
 
@@ -179,14 +228,7 @@ func (c *Context) WithTempHome() *Context {
 }
 
 func (c *Context) WithCwd(path string) *Context {
-	c.cwdBefore, _ = os.Getwd()
-	err := os.Chdir(path)
-	if err != nil {
-		panic(err)
-	}
-	c.after = append(c.after, func() {
-		os.Chdir(c.cwdBefore)
-	})
+	c.cwd = path
 	return c
 }
 
@@ -195,6 +237,9 @@ func (c *Context) WithHomeEnvFile(content string) *Context {
 }
 
 func (c *Context) WithFile(path string, content string) *Context {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.cwd, path)
+	}
 	_ = os.WriteFile(path, []byte(content), 0644)
 	c.after = append(c.after, func() {
 		_ = os.Remove(path)
@@ -214,70 +259,55 @@ func (c *Context) WithDir(path string) *Context {
 	return c
 }
 
-func (c *Context) Execute(callback func()) {
-	for _, before := range c.before {
-		before()
-	}
-	defer func() {
-		for _, after := range c.after {
-			after()
-		}
-	}()
-	callback()
-}
-
-func restoreInitialEnv() {
-	os.Clearenv()
-	for _, envEntry := range initialEnv {
-		keyValue := strings.Split(envEntry, "=")
-		os.Setenv(keyValue[0], keyValue[1])
+func (c *Context) Environ() []string {
+	var environ []string
+	for key, value := range c.env {
+		environ = append(environ, key+"="+value)
 	}
+	return environ
 }
 
 func (c *Context) Restore() {
-	defer restoreInitialEnv()
 	for _, after := range c.after {
 		//goland:noinspection GoDeferInLoop
 		defer after()
 	}
 }
 
-func context() *Context {
-	restoreInitialEnv()
+func newContext() *Context {
+	cwd, _ := os.Getwd()
+	env := map[string]string{}
+	for _, envEntry := range os.Environ() {
+		keyValue := strings.SplitN(envEntry, "=", 2)
+		env[keyValue[0]] = keyValue[1]
+	}
 	return &Context{
-		envBefore: os.Environ(),
+		env: env,
+		cwd: cwd,
 	}
 }
 
 func TestOverrideVersionWithGlobalEnvFile(t *testing.T) {
-	defer context().
+	c := newContext().
 		WithHome(dockerized.GetDockerizedRoot() + "/test/home").
-		WithHomeEnvFile("PROTOC_VERSION=3.8.0").
-		Restore()
+		WithHomeEnvFile("PROTOC_VERSION=3.8.0")
+	defer c.Restore()
 
-	var output = testDockerized(t, []string{"protoc", "--version"})
+	var output = testDockerized(t, c, []string{"protoc", "--version"})
 
 	assert.Contains(t, output, "3.8.0")
 }
 
-func capture(callback func()) string {
-	read, write, _ := os.Pipe()
-	os.Stdout = write
-
-	callback()
-
-	os.Stdout.Close()
-	bytes, _ := ioutil.ReadAll(read)
-	var output = string(bytes)
-	return output
-}
-
-func testDockerized(t *testing.T, args []string) string {
-	var err error
-	var exitCode int
-	var output = capture(func() {
-		err, exitCode = RunCli(args)
+func testDockerized(t *testing.T, c *Context, args []string) string {
+	var stdout bytes.Buffer
+	runner := dockerized.NewRunner(dockerized.Config{
+		Dir:    c.cwd,
+		Env:    c.Environ(),
+		Stdout: &stdout,
+		Stderr: &stdout,
 	})
+	err, exitCode := runner.Run(gocontext.Background(), args)
+	var output = stdout.String()
 	println(output)
 	assert.Nil(t, err, fmt.Sprintf("error: %s", err))
 	assert.Equal(t, 0, exitCode)
@@ -0,0 +1,297 @@
+package dockerized
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringList is a flag that can be repeated, e.g. `--mount a --mount b`.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// CommandDefinition is a command to add to a Compose File, with `dockerized add`.
+type CommandDefinition struct {
+	Name string
+	// Image is the image without its tag, which is selected by VersionVariable.
+	Image string
+	// Entrypoint is the command to run in the image. Defaults to the entrypoint of the image.
+	Entrypoint []string
+	// VersionVariable selects the tag of the image, e.g. DU_VERSION.
+	VersionVariable string
+	// Mounts are volumes in the short syntax of Compose, e.g. `${HOME}/.config:/root/.config`.
+	Mounts []string
+}
+
+// serviceNode returns the service of the command, as it is written to the Compose File.
+func (d CommandDefinition) serviceNode() *yaml.Node {
+	service := &yaml.Node{Kind: yaml.MappingNode}
+	service.Content = append(service.Content, yamlString("image", 0), yamlString(d.Image+":${"+d.VersionVariable+"}", yaml.DoubleQuotedStyle))
+	if len(d.Entrypoint) > 0 {
+		entrypoint := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, arg := range d.Entrypoint {
+			entrypoint.Content = append(entrypoint.Content, yamlString(arg, yaml.DoubleQuotedStyle))
+		}
+		service.Content = append(service.Content, yamlString("entrypoint", 0), entrypoint)
+	}
+	if len(d.Mounts) > 0 {
+		volumes := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, mount := range d.Mounts {
+			volumes.Content = append(volumes.Content, yamlString(mount, yaml.DoubleQuotedStyle))
+		}
+		service.Content = append(service.Content, yamlString("volumes", 0), volumes)
+	}
+	return service
+}
+
+func yamlString(value string, style yaml.Style) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style}
+}
+
+// AddServiceToComposeFile adds the service of the command to the content of a Compose File, keeping its comments.
+// An existing service with the same name is only replaced if replace is true.
+func AddServiceToComposeFile(content []byte, definition CommandDefinition, replace bool) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if document.Kind == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("the Compose File is not a mapping")
+	}
+
+	services := yamlMappingValue(root, "services")
+	if services == nil {
+		services = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, yamlString("services", 0), services)
+	}
+	if services.Kind != yaml.MappingNode {
+		return nil, errors.New("services in the Compose File is not a mapping")
+	}
+	// e.g. `services: {}`, as written by `dockerized init`
+	services.Style = 0
+
+	serviceNode := definition.serviceNode()
+	for i := 0; i < len(services.Content); i += 2 {
+		if services.Content[i].Value == definition.Name {
+			if !replace {
+				return nil, fmt.Errorf("command %s already exists, use --force to replace it", definition.Name)
+			}
+			services.Content[i+1] = serviceNode
+			return encodeYaml(&document)
+		}
+	}
+	services.Content = append(services.Content, yamlString(definition.Name, 0), serviceNode)
+	return encodeYaml(&document)
+}
+
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func encodeYaml(document *yaml.Node) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// findCustomComposeFile returns the Compose File that envFile adds to COMPOSE_FILE, in addition to the Compose Files of
+// the .env files before it.
+func findCustomComposeFile(envFiles []EnvFile, envFile EnvFile, separator string) (string, bool) {
+	inherited := map[string]bool{}
+	for _, other := range envFiles {
+		if other.Path == envFile.Path {
+			break
+		}
+		for _, path := range strings.Split(other.Variables["COMPOSE_FILE"], separator) {
+			inherited[path] = true
+		}
+	}
+	composeFilePath := ""
+	for _, path := range strings.Split(envFile.Variables["COMPOSE_FILE"], separator) {
+		if path != "" && !inherited[path] {
+			composeFilePath = path
+		}
+	}
+	return composeFilePath, composeFilePath != ""
+}
+
+func runAddCommand(_ context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	image := flags.String("image", "", "The image of the command, e.g. alpine or alpine:3.15. The tag is the default version.")
+	entrypoint := flags.String("entrypoint", "", "The command to run in the image. Defaults to the entrypoint of the image.")
+	versionVariable := flags.String("version-var", "", "The variable that selects the version. Defaults to <COMMAND>_VERSION.")
+	defaultVersion := flags.String("version", "", "The default version. Defaults to the tag of the image, or latest.")
+	var mounts stringList
+	flags.Var(&mounts, "mount", "A volume to mount, e.g. '${HOME}/.config:/root/.config'. Can be repeated.")
+	global := flags.Bool("global", false, "Add the command to the global Compose File, instead of the project's.")
+	force := flags.Bool("force", false, "Replace an existing command with the same name.")
+
+	// The name of the command comes first, e.g. `dockerized add du --image alpine`.
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+	if name == "" && flags.NArg() > 0 {
+		name = flags.Arg(0)
+	}
+	if name == "" || *image == "" || flags.NArg() > 1 || (flags.NArg() == 1 && flags.Arg(0) != name) {
+		return &UsageError{Message: fmt.Sprintf("add requires a command name and --image\nUsage: dockerized %s", meta.Command.Usage)}
+	}
+
+	ref, err := reference.ParseNormalizedNamed(*image)
+	if err != nil {
+		return fmt.Errorf("invalid image %s: %w", *image, err)
+	}
+	if _, ok := ref.(reference.Digested); ok {
+		return fmt.Errorf("invalid image %s: the version is selected by a tag, not a digest", *image)
+	}
+	definition := CommandDefinition{
+		Name:            name,
+		Image:           reference.FamiliarName(ref),
+		Entrypoint:      strings.Fields(*entrypoint),
+		VersionVariable: *versionVariable,
+		Mounts:          mounts,
+	}
+	if definition.VersionVariable == "" {
+		definition.VersionVariable = strings.ReplaceAll(strings.ToUpper(name), "-", "_") + "_VERSION"
+	}
+	version := *defaultVersion
+	if tagged, ok := ref.(reference.Tagged); ok && version == "" {
+		version = tagged.Tag()
+	}
+	if version == "" {
+		version = "latest"
+	}
+
+	// The dockerized.env that loads the Compose File
+	var envFilePath string
+	if *global {
+		envFilePath = filepath.Join(meta.Env.HomeDir(), dockerizedEnvFileName)
+	} else if projectEnvFile, err := findProjectEnvFile(meta.Dir); err == nil {
+		envFilePath = projectEnvFile
+	} else {
+		envFilePath = filepath.Join(meta.Env.HomeDir(), dockerizedEnvFileName)
+	}
+	var envFile *EnvFile
+	for i := range meta.EnvFiles {
+		if meta.EnvFiles[i].Path == envFilePath {
+			envFile = &meta.EnvFiles[i]
+		}
+	}
+	separator := meta.Env.Get("COMPOSE_PATH_SEPARATOR")
+	if separator == "" {
+		separator = ";"
+	}
+	composeFilePath := ""
+	if envFile != nil {
+		composeFilePath, _ = findCustomComposeFile(meta.EnvFiles, *envFile, separator)
+	}
+	if composeFilePath == "" {
+		if envFilePath == filepath.Join(meta.Env.HomeDir(), dockerizedEnvFileName) {
+			return fmt.Errorf("%s doesn't load a Compose File, add: COMPOSE_FILE=\"${COMPOSE_FILE};${HOME}/docker-compose.yml\"", envFilePath)
+		}
+		return fmt.Errorf("%s doesn't load a Compose File, run `dockerized init --force` to create one", envFilePath)
+	}
+
+	original, err := os.ReadFile(composeFilePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	existed := err == nil
+	content, err := AddServiceToComposeFile(original, definition, *force)
+	if err != nil {
+		return fmt.Errorf("%s: %w", composeFilePath, err)
+	}
+	if err = os.WriteFile(composeFilePath, content, 0644); err != nil {
+		return err
+	}
+
+	// Validate the result, and restore the Compose File if it doesn't load.
+	validateEnv := NewEnvironment(meta.Env.Environ())
+	if _, ok := validateEnv.Lookup(definition.VersionVariable); !ok {
+		validateEnv.Set(definition.VersionVariable, version)
+	}
+	composeFilePaths := meta.ComposeFilePaths
+	if !containsPath(composeFilePaths, composeFilePath) {
+		composeFilePaths = append(composeFilePaths, composeFilePath)
+	}
+	project, err := GetProject(composeFilePaths, validateEnv)
+	if err == nil {
+		_, err = project.GetService(name)
+	}
+	if err != nil {
+		if existed {
+			_ = os.WriteFile(composeFilePath, original, 0644)
+		} else {
+			_ = os.Remove(composeFilePath)
+		}
+		return fmt.Errorf("cannot add %s: %w", name, err)
+	}
+	fmt.Fprintf(meta.Stdout, "Added %s to %s\n", name, composeFilePath)
+
+	if _, ok := envFile.Variables[definition.VersionVariable]; ok {
+		fmt.Fprintf(meta.Stdout, "%s is already set in %s\n", definition.VersionVariable, envFilePath)
+		return nil
+	}
+	envContent, err := os.ReadFile(envFilePath)
+	if err != nil {
+		return err
+	}
+	if len(envContent) > 0 && !bytes.HasSuffix(envContent, []byte("\n")) {
+		envContent = append(envContent, '\n')
+	}
+	envContent = append(envContent, []byte(definition.VersionVariable+"="+version+"\n")...)
+	fileInfo, err := os.Stat(envFilePath)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(envFilePath, envContent, fileInfo.Mode().Perm()); err != nil {
+		return err
+	}
+	fmt.Fprintf(meta.Stdout, "Set %s=%s in %s\n", definition.VersionVariable, version, envFilePath)
+	return nil
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
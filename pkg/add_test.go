@@ -0,0 +1,84 @@
+package dockerized_test
+
+import (
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddToProject(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, _, err, _ := runFake(t, dir, dockerized.Config{}, "init")
+	assert.Nil(t, err)
+
+	_, output, err, _ := runFake(t, dir, dockerized.Config{}, "add", "du", "--image", "alpine:3.15", "--entrypoint", "du", "--mount", "${HOME}/.config:/root/.config")
+	assert.Nil(t, err)
+	composeFilePath := filepath.Join(dir, "docker-compose.yml")
+	envFilePath := filepath.Join(dir, "dockerized.env")
+	assert.Contains(t, output, "Added du to "+composeFilePath+"\n")
+	assert.Contains(t, output, "Set DU_VERSION=3.15 in "+envFilePath+"\n")
+
+	composeFile, _ := os.ReadFile(composeFilePath)
+	assert.Contains(t, string(composeFile), "# Commands of this project")
+	assert.Contains(t, string(composeFile), "services:\n  du:\n    image: \"alpine:${DU_VERSION}\"\n    entrypoint: [\"du\"]\n    volumes:\n      - \"${HOME}/.config:/root/.config\"\n")
+	envFile, _ := os.ReadFile(envFilePath)
+	assert.Contains(t, string(envFile), "\nDU_VERSION=3.15\n")
+
+	backend, _, err, _ := runFake(t, dir, dockerized.Config{}, "du", "-sh")
+	assert.Nil(t, err)
+	assert.Equal(t, "alpine:3.15", backend.LastRun().Service.Image)
+	assert.Equal(t, []string{"-sh"}, backend.LastRun().Options.Command)
+}
+
+func TestAddRefusesToReplace(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, _, err, _ := runFake(t, dir, dockerized.Config{}, "init")
+	assert.Nil(t, err)
+	_, _, err, _ = runFake(t, dir, dockerized.Config{}, "add", "du", "--image", "alpine", "--version-var", "ALPINE_VERSION")
+	assert.Nil(t, err)
+
+	_, _, err, exitCode := runFake(t, dir, dockerized.Config{}, "add", "du", "--image", "busybox")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, err.Error(), "use --force to replace it")
+
+	_, output, err, _ := runFake(t, dir, dockerized.Config{}, "add", "--force", "--image", "alpine", "--version", "3.14", "--version-var", "ALPINE_VERSION", "du")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "ALPINE_VERSION is already set in ")
+	envFile, _ := os.ReadFile(filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, string(envFile), "\nALPINE_VERSION=latest\n")
+	assert.NotContains(t, string(envFile), "3.14")
+}
+
+func TestAddToGlobalComposeFile(t *testing.T) {
+	t.Parallel()
+	home := t.TempDir()
+	globalEnv := "COMPOSE_FILE=\"${COMPOSE_FILE};${HOME}/docker-compose.yml\"\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(home, "dockerized.env"), []byte(globalEnv), 0644))
+
+	_, output, err, _ := runFake(t, t.TempDir(), dockerized.Config{Env: []string{"HOME=" + home}}, "add", "jq", "--image", "stedolan/jq")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Added jq to "+filepath.Join(home, "docker-compose.yml"))
+	envFile, _ := os.ReadFile(filepath.Join(home, "dockerized.env"))
+	assert.Equal(t, globalEnv+"JQ_VERSION=latest\n", string(envFile))
+
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{Env: []string{"HOME=" + home}}, "jq", "--version")
+	assert.Nil(t, err)
+	assert.Equal(t, "stedolan/jq:latest", backend.LastRun().Service.Image)
+}
+
+func TestAddWithoutComposeFile(t *testing.T) {
+	t.Parallel()
+	_, _, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{}, "add", "jq", "--image", "stedolan/jq")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, err.Error(), "doesn't load a Compose File")
+
+	_, _, err, exitCode = runFake(t, t.TempDir(), dockerized.Config{}, "add", "jq")
+	assert.IsType(t, &dockerized.UsageError{}, err)
+	assert.Equal(t, dockerized.ExitCodeUsage, exitCode)
+}
@@ -0,0 +1,184 @@
+package dockerized
+
+import (
+	"context"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/compose/v2/pkg/compose"
+	moby "github.com/docker/docker/api/types"
+	mobynetwork "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"sort"
+	"sync"
+)
+
+// Backend builds and runs the containers of commands.
+type Backend interface {
+	// Build builds the images of the services in options.
+	Build(ctx context.Context, project *types.Project, options api.BuildOptions) error
+	// SetupNetwork makes sure the networks used by the services of the project exist.
+	SetupNetwork(ctx context.Context, project *types.Project) error
+	// RunOneOffContainer runs the service in options, and returns its exit code.
+	RunOneOffContainer(ctx context.Context, project *types.Project, options api.RunOptions) (int, error)
+	// InspectImage returns the local image with the given reference. If it doesn't exist, the error satisfies
+	// errdefs.IsNotFound.
+	InspectImage(ctx context.Context, image string) (moby.ImageInspect, error)
+}
+
+// composeBackend runs containers with Docker Compose.
+type composeBackend struct {
+	service api.Service
+	client  networkClient
+	images  imageClient
+
+	mutex sync.Mutex
+	// Networks that are known to exist, to skip checking them again when running multiple commands.
+	networks map[string]bool
+}
+
+// networkClient is the part of the Docker API used to set up networks.
+type networkClient interface {
+	NetworkInspect(ctx context.Context, network string, options moby.NetworkInspectOptions) (moby.NetworkResource, error)
+	NetworkCreate(ctx context.Context, name string, options moby.NetworkCreate) (moby.NetworkCreateResponse, error)
+}
+
+// imageClient is the part of the Docker API used to inspect local images.
+type imageClient interface {
+	ImageInspectWithRaw(ctx context.Context, image string) (moby.ImageInspect, []byte, error)
+}
+
+// NewComposeBackend creates a Backend that runs containers with Docker Compose, attached to the given streams.
+func NewComposeBackend(streams Streams) (Backend, error) {
+	dockerCli, err := getDockerCli(
+		command.WithInputStream(streams.Stdin),
+		command.WithOutputStream(streams.Stdout),
+		command.WithErrorStream(streams.Stderr),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxy = api.NewServiceProxy()
+	proxy.WithService(compose.NewComposeService(dockerCli))
+	return &composeBackend{
+		service:  proxy,
+		client:   dockerCli.Client(),
+		images:   dockerCli.Client(),
+		networks: map[string]bool{},
+	}, nil
+}
+
+func (b *composeBackend) Build(ctx context.Context, project *types.Project, options api.BuildOptions) error {
+	return b.service.Build(ctx, project, options)
+}
+
+func (b *composeBackend) SetupNetwork(ctx context.Context, project *types.Project) error {
+	for _, key := range usedNetworks(project) {
+		network, ok := project.Networks[key]
+		if !ok {
+			return fmt.Errorf("network %s is not defined", key)
+		}
+		if b.isKnownNetwork(network.Name) {
+			continue
+		}
+		err := ensureNetwork(ctx, b.client, project.Name, key, network)
+		if err != nil {
+			return err
+		}
+		b.addKnownNetwork(network.Name)
+	}
+	return nil
+}
+
+func (b *composeBackend) RunOneOffContainer(ctx context.Context, project *types.Project, options api.RunOptions) (int, error) {
+	return b.service.RunOneOffContainer(ctx, project, options)
+}
+
+func (b *composeBackend) InspectImage(ctx context.Context, image string) (moby.ImageInspect, error) {
+	inspect, _, err := b.images.ImageInspectWithRaw(ctx, image)
+	return inspect, err
+}
+
+func (b *composeBackend) isKnownNetwork(name string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.networks[name]
+}
+
+func (b *composeBackend) addKnownNetwork(name string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.networks[name] = true
+}
+
+// usedNetworks returns the keys of the networks the services of the project are attached to.
+// Services with a network_mode, such as `host` or `none`, don't need a network.
+func usedNetworks(project *types.Project) []string {
+	var keys []string
+	for _, service := range project.Services {
+		if service.NetworkMode != "" {
+			continue
+		}
+		for key := range service.Networks {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return unique(keys)
+}
+
+// ensureNetwork creates the network if it doesn't exist yet. Existing networks and containers are left untouched, so
+// commands that are already running in the network are not affected.
+//
+// Multiple dockerized commands may try to create the network at the same time. The network is then created by only
+// one of them, and the others use it.
+func ensureNetwork(ctx context.Context, client networkClient, projectName string, key string, network types.NetworkConfig) error {
+	_, err := client.NetworkInspect(ctx, network.Name, moby.NetworkInspectOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return err
+	}
+	if network.External.External {
+		return fmt.Errorf("network %s declared as external, but could not be found", network.Name)
+	}
+
+	labels := map[string]string{}
+	for name, value := range network.Labels {
+		labels[name] = value
+	}
+	labels[api.NetworkLabel] = key
+	labels[api.ProjectLabel] = projectName
+	labels[api.VersionLabel] = api.ComposeVersion
+
+	createOptions := moby.NetworkCreate{
+		CheckDuplicate: true,
+		Labels:         labels,
+		Driver:         network.Driver,
+		Options:        network.DriverOpts,
+		Internal:       network.Internal,
+		Attachable:     network.Attachable,
+		EnableIPv6:     network.EnableIPv6,
+	}
+	if network.Ipam.Driver != "" || len(network.Ipam.Config) > 0 {
+		createOptions.IPAM = &mobynetwork.IPAM{Driver: network.Ipam.Driver}
+		for _, pool := range network.Ipam.Config {
+			createOptions.IPAM.Config = append(createOptions.IPAM.Config, mobynetwork.IPAMConfig{
+				Subnet:     pool.Subnet,
+				IPRange:    pool.IPRange,
+				Gateway:    pool.Gateway,
+				AuxAddress: pool.AuxiliaryAddresses,
+			})
+		}
+	}
+
+	_, err = client.NetworkCreate(ctx, network.Name, createOptions)
+	if err != nil && !errdefs.IsConflict(err) {
+		return fmt.Errorf("failed to create network %s: %w", network.Name, err)
+	}
+	// A conflict means the network was created by another command in the meantime.
+	return nil
+}
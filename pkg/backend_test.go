@@ -0,0 +1,130 @@
+package dockerized
+
+import (
+	"context"
+	"errors"
+	"github.com/compose-spec/compose-go/types"
+	moby "github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// networkDaemon simulates the network API of the Docker daemon.
+type networkDaemon struct {
+	mutex    sync.Mutex
+	networks map[string]moby.NetworkCreate
+	creates  int
+}
+
+func (d *networkDaemon) NetworkInspect(_ context.Context, network string, _ moby.NetworkInspectOptions) (moby.NetworkResource, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.networks[network]; !ok {
+		return moby.NetworkResource{}, errdefs.NotFound(errors.New("network " + network + " not found"))
+	}
+	return moby.NetworkResource{Name: network}, nil
+}
+
+func (d *networkDaemon) NetworkCreate(_ context.Context, name string, options moby.NetworkCreate) (moby.NetworkCreateResponse, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.creates++
+	if _, ok := d.networks[name]; ok && options.CheckDuplicate {
+		return moby.NetworkCreateResponse{}, errdefs.Conflict(errors.New("network with name " + name + " already exists"))
+	}
+	d.networks[name] = options
+	return moby.NetworkCreateResponse{ID: name}, nil
+}
+
+func TestEnsureNetworkCreatesMissingNetwork(t *testing.T) {
+	daemon := &networkDaemon{networks: map[string]moby.NetworkCreate{}}
+	err := ensureNetwork(context.Background(), daemon, "dockerized", "default", types.NetworkConfig{Name: "dockerized_default"})
+	assert.Nil(t, err)
+	assert.Contains(t, daemon.networks, "dockerized_default")
+	assert.Equal(t, "dockerized", daemon.networks["dockerized_default"].Labels["com.docker.compose.project"])
+	assert.Equal(t, "default", daemon.networks["dockerized_default"].Labels["com.docker.compose.network"])
+}
+
+func TestEnsureNetworkKeepsExistingNetwork(t *testing.T) {
+	existing := moby.NetworkCreate{Labels: map[string]string{"existing": "true"}}
+	daemon := &networkDaemon{networks: map[string]moby.NetworkCreate{"dockerized_default": existing}}
+	err := ensureNetwork(context.Background(), daemon, "dockerized", "default", types.NetworkConfig{Name: "dockerized_default"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, daemon.creates)
+	assert.Equal(t, existing, daemon.networks["dockerized_default"])
+}
+
+// The network may be created by another command between the inspection and the creation.
+func TestEnsureNetworkCreatedInBetween(t *testing.T) {
+	daemon := &networkDaemon{networks: map[string]moby.NetworkCreate{}}
+	client := &createBeforeCreateClient{networkDaemon: daemon}
+	err := ensureNetwork(context.Background(), client, "dockerized", "default", types.NetworkConfig{Name: "dockerized_default"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, daemon.creates)
+	assert.Len(t, daemon.networks, 1)
+}
+
+type createBeforeCreateClient struct {
+	*networkDaemon
+}
+
+func (c *createBeforeCreateClient) NetworkCreate(ctx context.Context, name string, options moby.NetworkCreate) (moby.NetworkCreateResponse, error) {
+	_, _ = c.networkDaemon.NetworkCreate(ctx, name, options)
+	return c.networkDaemon.NetworkCreate(ctx, name, options)
+}
+
+func TestEnsureNetworkConcurrently(t *testing.T) {
+	daemon := &networkDaemon{networks: map[string]moby.NetworkCreate{}}
+	network := types.NetworkConfig{Name: "dockerized_default"}
+
+	var wait sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			errs <- ensureNetwork(context.Background(), daemon, "dockerized", "default", network)
+		}()
+	}
+	wait.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Len(t, daemon.networks, 1)
+}
+
+func TestEnsureNetworkExternalNotFound(t *testing.T) {
+	daemon := &networkDaemon{networks: map[string]moby.NetworkCreate{}}
+	network := types.NetworkConfig{Name: "shared", External: types.External{External: true}}
+	err := ensureNetwork(context.Background(), daemon, "dockerized", "shared", network)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, daemon.creates)
+}
+
+func TestSetupNetworkOnlyChecksUsedNetworksOnce(t *testing.T) {
+	daemon := &networkDaemon{networks: map[string]moby.NetworkCreate{}}
+	backend := &composeBackend{client: daemon, networks: map[string]bool{}}
+	project := &types.Project{
+		Name: "dockerized",
+		Networks: types.Networks{
+			"default": {Name: "dockerized_default"},
+			"other":   {Name: "dockerized_other"},
+		},
+		Services: types.Services{
+			{Name: "go", Networks: map[string]*types.ServiceNetworkConfig{"default": nil}},
+			{Name: "host", NetworkMode: "host"},
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		err := backend.SetupNetwork(context.Background(), project)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, daemon.creates)
+	assert.Contains(t, daemon.networks, "dockerized_default")
+	assert.NotContains(t, daemon.networks, "dockerized_other")
+}
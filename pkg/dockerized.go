@@ -1,12 +1,9 @@
 package dockerized
 
 import (
-	"encoding/json"
 	"github.com/compose-spec/compose-go/dotenv"
 	"github.com/datastack-net/dockerized/pkg/util"
-	"github.com/hashicorp/go-version"
 	"io"
-	"net/http"
 )
 
 import (
@@ -18,26 +15,22 @@ import (
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/cli/cli/flags"
 	"github.com/docker/compose/v2/pkg/api"
-	"github.com/docker/compose/v2/pkg/compose"
-	"github.com/docker/distribution/reference"
-	"github.com/docker/hub-tool/pkg/hub"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
-	"syscall"
 )
 
 // Determine which docker-compose file to use. Assumes .env files are already loaded.
-func GetComposeFilePaths(dockerizedRoot string) []string {
+func GetComposeFilePaths(dockerizedRoot string, env *Environment) []string {
 	var composeFilePaths []string
-	composeFilePath := os.Getenv("COMPOSE_FILE")
+	composeFilePath := env.Get("COMPOSE_FILE")
 	if composeFilePath == "" {
 		composeFilePaths = append(composeFilePaths, filepath.Join(dockerizedRoot, "docker-compose.yml"))
 	} else {
-		composePathSeparator := os.Getenv("COMPOSE_PATH_SEPARATOR")
+		composePathSeparator := env.Get("COMPOSE_PATH_SEPARATOR")
 		if composePathSeparator == "" {
 			composePathSeparator = ";"
 		}
@@ -46,181 +39,51 @@ func GetComposeFilePaths(dockerizedRoot string) []string {
 	return composeFilePaths
 }
 
-func getNpmPackageVersions(packageName string) ([]string, error) {
-	var registryUrl = "https://registry.npmjs.org/" + packageName
-	request, err := http.NewRequest(http.MethodGet, registryUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-	request.Header.Add("Accept", "application/vnd.npm.install-v1+json")
-
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(response.Body)
-
-	// parse json
-	var registryResponse map[string]interface{}
-	err = json.NewDecoder(response.Body).Decode(&registryResponse)
+// SetCommandVersion sets the version variable of the command. Version ranges and partial versions are resolved to the
+// highest matching version with resolver, if not nil. Partial versions are used as they are, if they can't be resolved.
+func SetCommandVersion(ctx context.Context, out io.Writer, resolver *VersionResolver, composeFilePaths []string, env *Environment, commandName string, optionVerbose bool, commandVersion string) error {
+	rawProject, err := getRawProject(composeFilePaths)
 	if err != nil {
-		return nil, err
-	}
-	// read versions
-	var versions = registryResponse["versions"].(map[string]interface{})
-	var versionKeys = make([]string, 0, len(versions))
-	for k := range versions {
-		versionKeys = append(versionKeys, k)
+		return err
 	}
-	sort.Strings(versionKeys)
-	return versionKeys, nil
-}
 
-func PrintCommandVersions(composeFilePaths []string, commandName string, verbose bool) error {
-	project, err := GetProject(composeFilePaths)
+	rawService, err := rawProject.GetService(commandName)
 	if err != nil {
 		return err
 	}
 
-	service, err := project.GetService(commandName)
+	versionKey, err := getVersionVariable(rawService)
 	if err != nil {
 		return err
 	}
 
-	var semanticVersions []string
-	var rawVersions []string
-
-	isNpmPackage := len(service.Entrypoint) > 0 && service.Entrypoint[0] == "npx"
-	if isNpmPackage {
-		var packagePattern = regexp.MustCompile(`--package=(@?[^@]+)@([^\s]+)`)
-		packageArgument := service.Entrypoint[1]
-		packageMatch := packagePattern.FindStringSubmatch(packageArgument)
-		var packageName = packageMatch[1]
-		rawVersions, err = getNpmPackageVersions(packageName)
-		if err != nil {
-			return err
-		}
-	} else {
-		// isDockerHubImage
-		if service.Build != nil {
-			fmt.Printf("Cannot determine versions for command %s because it has a build step.\n", commandName)
-			os.Exit(1)
-		}
-
-		ref, err := reference.ParseDockerRef(service.Image)
-		if err != nil {
-			return err
-		}
-
-		refDomain := reference.Domain(ref)
-
-		if refDomain != "docker.io" {
-			fmt.Printf("Listing versions for commands is currently only supported for docker.io images.\n")
-			os.Exit(1)
-		}
-
-		refPath := reference.Path(ref)
-
-		hubClient, err := hub.NewClient(hub.WithAllElements())
-
-		if err != nil {
-			return err
-		}
-		tags, _, err := hubClient.GetTags(refPath)
-		if err != nil {
-			return err
-		}
-
-		for _, tag := range tags {
-			var tagParts = strings.Split(tag.Name, ":")
-			var tagVersion = tagParts[1]
-			rawVersions = append(rawVersions, tagVersion)
-		}
-	}
-	sort.Strings(rawVersions)
-	rawVersions = unique(rawVersions)
-	semanticVersions, err = getSemanticVersions(rawVersions)
-	sortVersions(semanticVersions)
-	semanticVersions = unique(semanticVersions)
-
-	if verbose {
-		fmt.Printf("\n")
-		fmt.Printf("Raw versions:\n")
-		for _, rawVersion := range rawVersions {
-			fmt.Printf("%s\n", rawVersion)
-		}
-		fmt.Printf("\n")
-	}
-
-	if len(semanticVersions) == 0 {
-		fmt.Printf("No parseable versions found for command %s.\n", commandName)
-		if len(rawVersions) > 0 {
-			fmt.Printf("Found: %s\n", strings.Join(rawVersions, ", "))
-		}
-		os.Exit(1)
-	}
-
-	var versionGroups = make(map[string][]string)
-	var versionGroupKeys []string
-	for _, semanticVersion := range semanticVersions {
-		var v, err = version.NewVersion(semanticVersion)
+	if resolver != nil && (IsVersionRange(commandVersion) || IsPartialVersion(commandVersion)) {
+		resolved, err := resolver.Resolve(ctx, composeFilePaths, env, commandName, versionKey, commandVersion)
 		if err != nil {
-			return err
-		}
-
-		var versionGroup string
-		var segments = v.Segments()
-		if len(segments) >= 2 {
-			versionGroup = fmt.Sprintf("%d.%d", segments[0], segments[1])
+			if IsVersionRange(commandVersion) {
+				return err
+			}
+			if optionVerbose {
+				fmt.Fprintf(out, "Cannot resolve %s, using it as is: %s\n", commandVersion, err)
+			}
 		} else {
-			versionGroup = fmt.Sprintf("%d.0", segments[0])
+			if optionVerbose {
+				fmt.Fprintf(out, "Resolved %s to %s\n", commandVersion, resolved)
+			}
+			commandVersion = resolved
 		}
-		versionGroups[versionGroup] = append(versionGroups[versionGroup], semanticVersion)
-		versionGroupKeys = append(versionGroupKeys, versionGroup)
 	}
-	versionGroupKeys = unique(versionGroupKeys)
-	sortVersions(versionGroupKeys)
 
-	for _, versionGroup := range versionGroupKeys {
-		var versions = versionGroups[versionGroup]
-		fmt.Printf("%s\n", strings.Join(versions, ", "))
+	if optionVerbose {
+		fmt.Fprintf(out, "Setting %s to %s...\n", versionKey, commandVersion)
 	}
+	env.Set(versionKey, commandVersion)
 	return nil
 }
 
-func getSemanticVersions(rawVersions []string) ([]string, error) {
-	var semanticVersions []string
-	for _, rawVersion := range rawVersions {
-		var semanticVersion = regexp.MustCompile(`^v?(\d+(\.\d+)*$)`).FindStringSubmatch(rawVersion)
-		if semanticVersion != nil {
-			semanticVersions = append(semanticVersions, semanticVersion[1])
-		}
-	}
-	return semanticVersions, nil
-}
-
-func sortVersions(versions []string) {
-	sort.Slice(versions, func(i, j int) bool {
-		v1, e1 := version.NewVersion(versions[i])
-		v2, e2 := version.NewVersion(versions[j])
-		return e1 == nil && e2 == nil && v1.LessThan(v2)
-	})
-}
-
-func SetCommandVersion(composeFilePaths []string, commandName string, optionVerbose bool, commandVersion string) {
-	rawProject, err := getRawProject(composeFilePaths)
-	if err != nil {
-		panic(err)
-	}
-
-	rawService, err := rawProject.GetService(commandName)
-
+// getVersionVariable returns the variable that selects the version of a service, by the <COMMAND>_VERSION convention.
+func getVersionVariable(rawService types.ServiceConfig) (string, error) {
+	commandName := rawService.Name
 	var versionVariableExpected = strings.ReplaceAll(strings.ToUpper(commandName), "-", "_") + "_VERSION"
 	var variablesUsed []string
 	for _, variable := range ExtractVariables(rawService) {
@@ -228,8 +91,7 @@ func SetCommandVersion(composeFilePaths []string, commandName string, optionVerb
 	}
 
 	if len(variablesUsed) == 0 {
-		fmt.Printf("Error: Version selection for %s is currently not supported.\n", commandName)
-		os.Exit(1)
+		return "", &UnsupportedVersionSelectionError{Command: commandName}
 	}
 
 	var versionVariablesUsed []string
@@ -238,135 +100,176 @@ func SetCommandVersion(composeFilePaths []string, commandName string, optionVerb
 			versionVariablesUsed = append(versionVariablesUsed, variable)
 		}
 	}
-	versionKey := versionVariableExpected
-
-	if !util.Contains(variablesUsed, versionVariableExpected) {
-		if len(versionVariablesUsed) == 1 {
-			fmt.Printf("Error: To specify the version of %s, please set %s.\n",
-				commandName,
-				versionVariablesUsed[0],
-			)
-			os.Exit(1)
-		} else if len(versionVariablesUsed) > 1 {
-			fmt.Printf("Error: To specify the version of %s, please set one of:\n", commandName)
-			for _, versionVariable := range versionVariablesUsed {
-				fmt.Println("  " + versionVariable)
-			}
-			os.Exit(1)
-		}
-	}
 
-	if optionVerbose {
-		fmt.Printf("Setting %s to %s...\n", versionKey, commandVersion)
-	}
-	err = os.Setenv(versionKey, commandVersion)
-	if err != nil {
-		panic(err)
+	if !util.Contains(variablesUsed, versionVariableExpected) && len(versionVariablesUsed) > 0 {
+		return "", &AmbiguousVersionVariableError{Command: commandName, Variables: versionVariablesUsed}
 	}
+	return versionVariableExpected, nil
+}
+
+// EnvFile contains the variables loaded from a .env file.
+type EnvFile struct {
+	Path      string
+	Variables map[string]string
+	// Lines contains the line number of the definition of each variable.
+	Lines map[string]int
 }
 
-func LoadEnvFiles(hostCwd string, optionVerbose bool) error {
-	var envFiles []string
+// LoadEnvFiles adds the variables from the default .env file, and the global and project dockerized.env files to env.
+// Variables already in env take precedence. Returns the files that were loaded, in order of precedence, from low to high.
+//
+// If DOCKERIZED_VERSION_FILES is enabled, the versions in files of other tools, such as .nvmrc or go.mod, are loaded
+// as well, with a lower precedence than the project dockerized.env. See versionFiles.
+func LoadEnvFiles(env *Environment, dockerizedRoot string, hostCwd string) ([]EnvFile, error) {
+	var envFilePaths []string
 
 	// Default
-	defaultEnvFile := filepath.Join(GetDockerizedRoot(), ".env")
-	envFiles = append(envFiles, defaultEnvFile)
+	defaultEnvFile := filepath.Join(dockerizedRoot, ".env")
+	envFilePaths = append(envFilePaths, defaultEnvFile)
 
 	// Global overrides
-	homeDir, _ := os.UserHomeDir()
-	globalUserEnvFile := filepath.Join(homeDir, dockerizedEnvFileName)
+	globalUserEnvFile := filepath.Join(env.HomeDir(), dockerizedEnvFileName)
 	if _, err := os.Stat(globalUserEnvFile); err == nil {
-		envFiles = append(envFiles, globalUserEnvFile)
+		envFilePaths = append(envFilePaths, globalUserEnvFile)
 	}
 
 	// Project overrides
-	if projectEnvFile, err := findProjectEnvFile(hostCwd); err == nil {
-		envFiles = append(envFiles, projectEnvFile)
-		os.Setenv("DOCKERIZED_PROJECT_ROOT", filepath.Dir(projectEnvFile))
+	projectEnvFile, err := findProjectEnvFile(hostCwd)
+	if err != nil {
+		projectEnvFile = ""
+	} else {
+		envFilePaths = append(envFilePaths, projectEnvFile)
+		env.Set("DOCKERIZED_PROJECT_ROOT", filepath.Dir(projectEnvFile))
 	}
 
-	envFiles = unique(envFiles)
+	envFilePaths = unique(envFilePaths)
 
-	if optionVerbose {
-		for _, envFile := range envFiles {
-			fmt.Printf("Loading: '%s'\n", envFile)
+	envFiles, envMap, err := readEnvFiles(env, envFilePaths, projectEnvFile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions of other tools
+	versionFilesOption := env.Get("DOCKERIZED_VERSION_FILES")
+	if versionFilesOption == "" {
+		versionFilesOption = envMap["DOCKERIZED_VERSION_FILES"]
+	}
+	if enabled, _ := strconv.ParseBool(versionFilesOption); enabled {
+		versionEnvFiles, err := readVersionFiles(findVersionFilesRoot(env, hostCwd), defaultEnvFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(versionEnvFiles) > 0 {
+			envFiles, envMap, err = readEnvFiles(env, envFilePaths, projectEnvFile, versionEnvFiles)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for key, value := range envMap {
+		if _, exists := env.Lookup(key); !exists {
+			env.Set(key, value)
 		}
 	}
 
+	return envFiles, nil
+}
+
+// readEnvFiles reads the .env files, and merges their variables. The version files are inserted before the project
+// dockerized.env, if any.
+func readEnvFiles(env *Environment, envFilePaths []string, projectEnvFilePath string, versionEnvFiles []EnvFile) ([]EnvFile, map[string]string, error) {
+	var envFiles []EnvFile
 	var envMap = make(map[string]string)
-	err := func() error {
-		for _, envFilePath := range envFiles {
-			file, err := os.Open(envFilePath)
-			if err != nil {
-				return err
+	addEnvFile := func(envFile EnvFile) {
+		for key, value := range envFile.Variables {
+			envMap[key] = value
+		}
+		envFiles = append(envFiles, envFile)
+	}
+	for _, envFilePath := range envFilePaths {
+		if envFilePath == projectEnvFilePath {
+			for _, versionEnvFile := range versionEnvFiles {
+				addEnvFile(versionEnvFile)
 			}
-			defer file.Close()
-
-			envFileMap, err := dotenv.ParseWithLookup(file, func(key string) (string, bool) {
-				// 1. Lookup in the environment
-				var envValue = os.Getenv(key)
-				if envValue != "" {
-					return envValue, true
-				}
-				// 2. Lookup in previous env files
-				if envMap[key] != "" {
-					return envMap[key], true
-				}
-				return "", false
-			})
-			if err != nil {
-				return err
+		}
+		envFile, err := readEnvFile(envFilePath, func(key string) (string, bool) {
+			// 1. Lookup in the environment
+			var envValue = env.Get(key)
+			if envValue != "" {
+				return envValue, true
 			}
-			for key, value := range envFileMap {
-				envMap[key] = value
+			// 2. Lookup in previous env files
+			if envMap[key] != "" {
+				return envMap[key], true
 			}
+			return "", false
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		addEnvFile(envFile)
+	}
+	if projectEnvFilePath == "" {
+		for _, versionEnvFile := range versionEnvFiles {
+			addEnvFile(versionEnvFile)
 		}
-		return nil
-	}()
+	}
+	return envFiles, envMap, nil
+}
 
+var envFileLinePattern = regexp.MustCompile(`^\s*(?:export\s+)?([A-Za-z0-9_.\-]+)\s*[=:]`)
+
+func readEnvFile(path string, lookup dotenv.LookupFn) (EnvFile, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return EnvFile{}, err
 	}
-
-	currentEnv := map[string]bool{}
-	rawEnv := os.Environ()
-	for _, rawEnvLine := range rawEnv {
-		key := strings.Split(rawEnvLine, "=")[0]
-		currentEnv[key] = true
+	variables, err := dotenv.UnmarshalBytesWithLookup(content, lookup)
+	if err != nil {
+		return EnvFile{}, fmt.Errorf("%s: %w", path, err)
 	}
 
-	for key, value := range envMap {
-		if !currentEnv[key] {
-			_ = os.Setenv(key, value)
+	lines := map[string]int{}
+	for index, line := range strings.Split(string(content), "\n") {
+		match := envFileLinePattern.FindStringSubmatch(line)
+		if match != nil {
+			if _, ok := variables[match[1]]; ok {
+				// The last definition wins, as in the parser.
+				lines[match[1]] = index + 1
+			}
 		}
 	}
 
-	return nil
+	return EnvFile{
+		Path:      path,
+		Variables: variables,
+		Lines:     lines,
+	}, nil
 }
 
-func dockerComposeRunAdHocService(service types.ServiceConfig, runOptions api.RunOptions) (error, int) {
+func dockerComposeRunAdHocService(ctx context.Context, backend Backend, service types.ServiceConfig, runOptions api.RunOptions, serviceOptions ...func(config *types.ServiceConfig) error) (error, int) {
 	if service.Environment == nil {
 		service.Environment = map[string]*string{}
 	}
-	return DockerComposeRun(&types.Project{
+	return DockerComposeRun(ctx, backend, &types.Project{
 		Name: "dockerized",
 		Services: []types.ServiceConfig{
 			service,
 		},
-		WorkingDir: GetDockerizedRoot(),
-	}, runOptions, []types.ServiceVolumeConfig{})
+	}, runOptions, []types.ServiceVolumeConfig{}, serviceOptions...)
 }
 
-func DockerRun(image string, runOptions api.RunOptions, volumes []types.ServiceVolumeConfig) (error, int) {
+func DockerRun(ctx context.Context, backend Backend, image string, runOptions api.RunOptions, volumes []types.ServiceVolumeConfig, serviceOptions ...func(config *types.ServiceConfig) error) (error, int) {
 	// Couldn't get 'docker run' to work, so instead define a Docker Compose Service and run that.
 	// This coincidentally allows re-using the same code for both 'docker run' and 'docker-compose run'
 	// - ContainerCreate is simple, but the logic to attach to it is very complex, and not exposed by the Docker SDK.
 	// - Using [container.NewRunCommand] didn't work due to dependency compatibility issues.
-	return dockerComposeRunAdHocService(types.ServiceConfig{
+	return dockerComposeRunAdHocService(ctx, backend, types.ServiceConfig{
 		Name:    runOptions.Service,
 		Image:   image,
 		Volumes: volumes,
-	}, runOptions)
+	}, runOptions, serviceOptions...)
 }
 
 var dockerizedEnvFileName = "dockerized.env"
@@ -393,23 +296,24 @@ func findProjectEnvFile(path string) (string, error) {
 	}
 	return "", fmt.Errorf("no local %s found", dockerizedEnvFileName)
 }
-func NormalizeEnvironment(dockerizedRoot string) {
-	_ = os.Setenv("DOCKERIZED_ROOT", dockerizedRoot)
-	homeDir, _ := os.UserHomeDir()
-	if os.Getenv("HOME") == "" {
-		_ = os.Setenv("HOME", homeDir)
+
+// findProjectEnvFileBelowHome returns the dockerized.env of the project in path, like findProjectEnvFile, but stops at
+// the home directory, as the dockerized.env there is the global one. See GetProjectRoot.
+func findProjectEnvFileBelowHome(path string, homeDir string) (string, error) {
+	for i := 0; i < 10 && !samePath(path, homeDir); i++ {
+		envFilePath := filepath.Join(path, dockerizedEnvFileName)
+		if _, err := os.Stat(envFilePath); err == nil {
+			return envFilePath, nil
+		}
+		path = filepath.Dir(path)
 	}
+	return "", fmt.Errorf("no project %s found", dockerizedEnvFileName)
 }
-
-func newSigContext() (context.Context, func()) {
-	ctx, cancel := context.WithCancel(context.Background())
-	s := make(chan os.Signal, 1)
-	signal.Notify(s, syscall.SIGTERM, syscall.SIGINT)
-	go func() {
-		<-s
-		cancel()
-	}()
-	return ctx, cancel
+func NormalizeEnvironment(env *Environment, dockerizedRoot string) {
+	env.Set("DOCKERIZED_ROOT", dockerizedRoot)
+	if env.Get("HOME") == "" {
+		env.Set("HOME", env.HomeDir())
+	}
 }
 
 func getRawProject(composeFilePaths []string) (*types.Project, error) {
@@ -423,16 +327,17 @@ func getRawProject(composeFilePaths []string) (*types.Project, error) {
 	)
 
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
 	return cli.ProjectFromOptions(options)
 }
 
-func GetProject(composeFilePaths []string) (*types.Project, error) {
-	options, err := cli.NewProjectOptions([]string{},
-		cli.WithOsEnv,
-		cli.WithConfigFileEnv,
+func GetProject(composeFilePaths []string, env *Environment) (*types.Project, error) {
+	options, err := cli.NewProjectOptions(composeFilePaths,
+		cli.WithEnv(env.Environ()),
+		// Resolve relative paths against the directory of the first Compose File, instead of the working directory.
+		cli.WithResolvedPaths(true),
 	)
 
 	if err != nil {
@@ -442,27 +347,8 @@ func GetProject(composeFilePaths []string) (*types.Project, error) {
 	return cli.ProjectFromOptions(options)
 }
 
-func dockerComposeUpNetworkOnly(backend *api.ServiceProxy, ctx context.Context, project *types.Project) error {
-	project.Services = []types.ServiceConfig{}
-	upOptions := api.UpOptions{
-		Create: api.CreateOptions{
-			Services:      []string{},
-			RemoveOrphans: true,
-			Recreate:      "always",
-		},
-	}
-	err := backend.Up(ctx, project, upOptions)
-
-	// docker compose up will return error if there is no service to start, but the network will have been created.
-	expectedErrorMessage := "no container found for project \"" + project.Name + "\": not found"
-	if err == nil || api.IsNotFoundError(err) && err.Error() == expectedErrorMessage {
-		return nil
-	}
-	return err
-}
-
-func getDockerCli() (*command.DockerCli, error) {
-	dockerCli, err := command.NewDockerCli()
+func getDockerCli(options ...command.DockerCliOption) (*command.DockerCli, error) {
+	dockerCli, err := command.NewDockerCli(options...)
 	if err != nil {
 		return nil, err
 	}
@@ -474,46 +360,17 @@ func getDockerCli() (*command.DockerCli, error) {
 	return dockerCli, nil
 }
 
-func getBackend() (*api.ServiceProxy, error) {
-	dockerCli, err := getDockerCli()
-	if err != nil {
-		return nil, err
-	}
-
-	var backend = api.NewServiceProxy()
-	composeService := compose.NewComposeService(dockerCli)
-	backend.WithService(composeService)
-	return backend, nil
-}
-
-func DockerComposeBuild(composeFilePaths []string, buildOptions api.BuildOptions) error {
-	project, err := GetProject(composeFilePaths)
-	if err != nil {
-		return err
-	}
-	err = os.Chdir(project.WorkingDir)
-	if err != nil {
-		return err
-	}
-
-	backend, err := getBackend()
-	if err != nil {
-		return err
-	}
-	ctx, _ := newSigContext()
+func DockerComposeBuild(ctx context.Context, backend Backend, project *types.Project, buildOptions api.BuildOptions) error {
 	return backend.Build(ctx, project, buildOptions)
 }
 
-func DockerComposeRun(project *types.Project, runOptions api.RunOptions, volumes []types.ServiceVolumeConfig, serviceOptions ...func(config *types.ServiceConfig) error) (error, int) {
-	err := os.Chdir(project.WorkingDir)
-	if err != nil {
-		return err, 1
-	}
-	ctx, _ := newSigContext()
-
+func DockerComposeRun(ctx context.Context, backend Backend, project *types.Project, runOptions api.RunOptions, volumes []types.ServiceVolumeConfig, serviceOptions ...func(config *types.ServiceConfig) error) (error, int) {
 	serviceName := runOptions.Service
 
 	service, err := project.GetService(serviceName)
+	if err != nil {
+		return err, 1
+	}
 	if service.CustomLabels == nil {
 		service.CustomLabels = map[string]string{}
 	}
@@ -531,18 +388,13 @@ func DockerComposeRun(project *types.Project, runOptions api.RunOptions, volumes
 	service.StopGracePeriod = &stopGracePeriod
 	service.StdinOpen = true
 
-	backend, err := getBackend()
-	if err != nil {
-		return err, 1
-	}
+	project.Services = []types.ServiceConfig{service}
 
-	err = dockerComposeUpNetworkOnly(backend, ctx, project)
+	err = backend.SetupNetwork(ctx, project)
 	if err != nil {
 		return err, 1
 	}
 
-	project.Services = []types.ServiceConfig{service}
-
 	exitCode, err := backend.RunOneOffContainer(ctx, project, runOptions)
 	if err != nil {
 		return err, exitCode
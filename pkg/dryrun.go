@@ -0,0 +1,219 @@
+package dockerized
+
+import (
+	"context"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/compose/v2/pkg/api"
+	moby "github.com/docker/docker/api/types"
+	"gopkg.in/yaml.v2"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dryRunBackend prints what would be run, instead of running it.
+type dryRunBackend struct {
+	out io.Writer
+}
+
+// NewDryRunBackend creates a Backend that prints the resolved service and the equivalent `docker run` command to out,
+// without building or running anything.
+func NewDryRunBackend(out io.Writer) Backend {
+	return &dryRunBackend{out: out}
+}
+
+func (b *dryRunBackend) Build(_ context.Context, project *types.Project, options api.BuildOptions) error {
+	args := []string{"docker", "compose", "--project-name", project.Name}
+	for _, composeFile := range project.ComposeFiles {
+		args = append(args, "-f", composeFile)
+	}
+	args = append(args, "build")
+	if options.Pull {
+		args = append(args, "--pull")
+	}
+	if options.NoCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, options.Services...)
+
+	fmt.Fprintf(b.out, "# Build\n%s\n\n", shellJoin(args))
+	return nil
+}
+
+func (b *dryRunBackend) SetupNetwork(_ context.Context, _ *types.Project) error {
+	return nil
+}
+
+func (b *dryRunBackend) InspectImage(_ context.Context, image string) (moby.ImageInspect, error) {
+	return moby.ImageInspect{}, fmt.Errorf("cannot inspect image %s in a dry run", image)
+}
+
+func (b *dryRunBackend) RunOneOffContainer(_ context.Context, project *types.Project, options api.RunOptions) (int, error) {
+	service, err := project.GetService(options.Service)
+	if err != nil {
+		return 1, err
+	}
+	applyRunOptions(&service, options)
+
+	serviceYaml, err := yaml.Marshal(map[string]interface{}{
+		"services": map[string]types.ServiceConfig{
+			service.Name: service,
+		},
+	})
+	if err != nil {
+		return 1, err
+	}
+
+	fmt.Fprintf(b.out, "# Service\n%s\n", serviceYaml)
+	fmt.Fprintf(b.out, "# Command\n%s\n", shellJoin(DockerRunCommand(project, service, options)))
+	return 0, nil
+}
+
+// Applies the options of `docker compose run` to the service, as Docker Compose does.
+func applyRunOptions(service *types.ServiceConfig, options api.RunOptions) {
+	service.Tty = options.Tty
+	service.StdinOpen = true
+	if len(options.Command) > 0 {
+		service.Command = options.Command
+	}
+	if len(options.User) > 0 {
+		service.User = options.User
+	}
+	if len(options.WorkingDir) > 0 {
+		service.WorkingDir = options.WorkingDir
+	}
+	if options.Entrypoint != nil {
+		service.Entrypoint = options.Entrypoint
+	}
+	if len(options.Environment) > 0 {
+		if service.Environment == nil {
+			service.Environment = types.MappingWithEquals{}
+		}
+		service.Environment.OverrideBy(types.NewMappingWithEquals(options.Environment))
+	}
+}
+
+// DockerRunCommand returns the `docker run` command line equivalent to running the service.
+func DockerRunCommand(project *types.Project, service types.ServiceConfig, options api.RunOptions) []string {
+	args := []string{"docker", "run"}
+	if options.AutoRemove {
+		args = append(args, "--rm")
+	}
+	if service.StdinOpen {
+		args = append(args, "-i")
+	}
+	if service.Tty {
+		args = append(args, "-t")
+	}
+
+	if service.NetworkMode != "" {
+		args = append(args, "--network", service.NetworkMode)
+	} else {
+		for _, key := range service.NetworksByPriority() {
+			if network, ok := project.Networks[key]; ok && network.Name != "" {
+				args = append(args, "--network", network.Name)
+				break
+			}
+		}
+	}
+
+	if service.User != "" {
+		args = append(args, "--user", service.User)
+	}
+	if service.WorkingDir != "" {
+		args = append(args, "--workdir", service.WorkingDir)
+	}
+	if service.Privileged {
+		args = append(args, "--privileged")
+	}
+	for _, capability := range service.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+	for _, device := range service.Devices {
+		args = append(args, "--device", device)
+	}
+	for _, host := range service.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+
+	var environmentKeys []string
+	for key := range service.Environment {
+		environmentKeys = append(environmentKeys, key)
+	}
+	sort.Strings(environmentKeys)
+	for _, key := range environmentKeys {
+		value := service.Environment[key]
+		if value == nil {
+			args = append(args, "-e", key)
+		} else {
+			args = append(args, "-e", key+"="+*value)
+		}
+	}
+
+	for _, volume := range service.Volumes {
+		source := volume.Source
+		if volume.Type == types.VolumeTypeVolume {
+			if projectVolume, ok := project.Volumes[source]; ok && projectVolume.Name != "" {
+				source = projectVolume.Name
+			}
+		}
+		mount := volume.Target
+		if source != "" {
+			mount = source + ":" + volume.Target
+		}
+		if volume.ReadOnly {
+			mount += ":ro"
+		}
+		args = append(args, "-v", mount)
+	}
+	for _, tmpfs := range service.Tmpfs {
+		args = append(args, "--tmpfs", tmpfs)
+	}
+
+	for _, port := range service.Ports {
+		mapping := fmt.Sprintf("%d", port.Target)
+		if port.Published != "" {
+			mapping = port.Published + ":" + mapping
+		}
+		if port.HostIP != "" {
+			mapping = port.HostIP + ":" + mapping
+		}
+		if port.Protocol != "" && port.Protocol != "tcp" {
+			mapping += "/" + port.Protocol
+		}
+		args = append(args, "-p", mapping)
+	}
+
+	// docker run only accepts the executable as entrypoint. Its arguments are passed before the command.
+	var entrypointArgs []string
+	if len(service.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", service.Entrypoint[0])
+		entrypointArgs = service.Entrypoint[1:]
+	}
+
+	image := service.Image
+	if image == "" {
+		image = project.Name + "_" + service.Name
+	}
+	args = append(args, image)
+	args = append(args, entrypointArgs...)
+	args = append(args, service.Command...)
+	return args
+}
+
+var shellSafePattern = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// shellJoin joins args into a command line for POSIX shells, quoting the arguments where needed.
+func shellJoin(args []string) string {
+	var quoted []string
+	for _, arg := range args {
+		if shellSafePattern.MatchString(arg) {
+			quoted = append(quoted, arg)
+		} else {
+			quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'"'"'`)+"'")
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,60 @@
+package dockerized
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Environment contains the variables used to evaluate Compose Files and dockerized settings.
+// It is separate from the process environment, so multiple commands can be run from the same process.
+type Environment struct {
+	variables map[string]string
+}
+
+// NewEnvironment creates an Environment from `KEY=value` pairs, as returned by os.Environ.
+func NewEnvironment(environ []string) *Environment {
+	env := &Environment{variables: map[string]string{}}
+	for _, entry := range environ {
+		keyValue := strings.SplitN(entry, "=", 2)
+		if len(keyValue) == 2 && keyValue[0] != "" {
+			env.variables[keyValue[0]] = keyValue[1]
+		}
+	}
+	return env
+}
+
+func (e *Environment) Get(key string) string {
+	return e.variables[key]
+}
+
+func (e *Environment) Lookup(key string) (string, bool) {
+	value, ok := e.variables[key]
+	return value, ok
+}
+
+func (e *Environment) Set(key string, value string) {
+	e.variables[key] = value
+}
+
+// Environ returns the variables as sorted `KEY=value` pairs.
+func (e *Environment) Environ() []string {
+	var environ []string
+	for key, value := range e.variables {
+		environ = append(environ, key+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// HomeDir returns the home directory of the user, according to the environment.
+func (e *Environment) HomeDir() string {
+	if home := e.Get("HOME"); home != "" {
+		return home
+	}
+	if home := e.Get("USERPROFILE"); home != "" {
+		return home
+	}
+	home, _ := os.UserHomeDir()
+	return home
+}
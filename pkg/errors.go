@@ -0,0 +1,224 @@
+package dockerized
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Exit codes of dockerized itself. Exit codes of commands are passed through unchanged.
+const (
+	ExitCodeError = 1
+	ExitCodeUsage = 2
+	// ExitCodeVersionNotFound is used when the image of the requested version of a command doesn't exist.
+	ExitCodeVersionNotFound = 3
+)
+
+// ExitCoder is implemented by errors that define the exit code of dockerized.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitCode returns the exit code for err: 0 if err is nil, the exit code defined by err, or ExitCodeError.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitCoder ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+	return ExitCodeError
+}
+
+// UsageError is returned when dockerized is called with invalid options.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func (e *UsageError) ExitCode() int {
+	return ExitCodeUsage
+}
+
+type UnknownOptionError struct {
+	Option string
+}
+
+func (e *UnknownOptionError) Error() string {
+	return fmt.Sprintf("unknown option: %s", e.Option)
+}
+
+func (e *UnknownOptionError) ExitCode() int {
+	return ExitCodeUsage
+}
+
+// UnsupportedVersionSelectionError is returned when a version is specified for a command that doesn't use any
+// variables.
+type UnsupportedVersionSelectionError struct {
+	Command string
+}
+
+func (e *UnsupportedVersionSelectionError) Error() string {
+	return fmt.Sprintf("version selection for %s is currently not supported", e.Command)
+}
+
+func (e *UnsupportedVersionSelectionError) ExitCode() int {
+	return ExitCodeError
+}
+
+// AmbiguousVersionVariableError is returned when the version of a command can't be set with `<command>:<version>`,
+// because its version variable doesn't follow the <COMMAND>_VERSION convention.
+type AmbiguousVersionVariableError struct {
+	Command   string
+	Variables []string
+}
+
+func (e *AmbiguousVersionVariableError) Error() string {
+	if len(e.Variables) == 1 {
+		return fmt.Sprintf("to specify the version of %s, please set %s", e.Command, e.Variables[0])
+	}
+	return fmt.Sprintf("to specify the version of %s, please set one of:\n  %s", e.Command, strings.Join(e.Variables, "\n  "))
+}
+
+func (e *AmbiguousVersionVariableError) ExitCode() int {
+	return ExitCodeError
+}
+
+// UnsupportedVersionSourceError is returned when the version source of a command is not registered.
+type UnsupportedVersionSourceError struct {
+	Command string
+	Source  string
+}
+
+func (e *UnsupportedVersionSourceError) Error() string {
+	return fmt.Sprintf("cannot list versions for command %s: unknown version source %s", e.Command, e.Source)
+}
+
+func (e *UnsupportedVersionSourceError) ExitCode() int {
+	return ExitCodeError
+}
+
+// BuildStepError is returned when versions can't be listed for a command, because its image is built locally.
+type BuildStepError struct {
+	Command string
+}
+
+func (e *BuildStepError) Error() string {
+	return fmt.Sprintf("cannot determine versions for command %s because it has a build step, please set x-dockerized.versions.source", e.Command)
+}
+
+func (e *BuildStepError) ExitCode() int {
+	return ExitCodeError
+}
+
+// NoVersionsError is returned when none of the versions found for a command could be parsed.
+type NoVersionsError struct {
+	Command     string
+	RawVersions []string
+}
+
+func (e *NoVersionsError) Error() string {
+	message := fmt.Sprintf("no parseable versions found for command %s", e.Command)
+	if len(e.RawVersions) > 0 {
+		message += fmt.Sprintf("\nFound: %s", strings.Join(e.RawVersions, ", "))
+	}
+	return message
+}
+
+func (e *NoVersionsError) ExitCode() int {
+	return ExitCodeError
+}
+
+// NoMatchingVersionError is returned when none of the versions of a command match a version range.
+type NoMatchingVersionError struct {
+	Command string
+	Range   string
+}
+
+func (e *NoMatchingVersionError) Error() string {
+	return fmt.Sprintf("no version of %s matches %s, see `dockerized %s:?`", e.Command, e.Range, e.Command)
+}
+
+func (e *NoMatchingVersionError) ExitCode() int {
+	return ExitCodeError
+}
+
+// VersionNotFoundError is returned when the image for the configured version of a command doesn't exist.
+type VersionNotFoundError struct {
+	Command string
+	Version string
+	// Variable is the version variable of the command, e.g. NODE_VERSION.
+	Variable string
+	// Closest are the available versions closest to Version.
+	Closest []string
+	Err     error
+}
+
+func (e *VersionNotFoundError) Error() string {
+	if len(e.Closest) == 0 {
+		return fmt.Sprintf("version %s not found for %s, see `dockerized %s:?`", e.Version, e.Command, e.Command)
+	}
+	return fmt.Sprintf("version %s not found for %s; closest available: %s", e.Version, e.Command, strings.Join(e.Closest, ", "))
+}
+
+func (e *VersionNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *VersionNotFoundError) ExitCode() int {
+	return ExitCodeVersionNotFound
+}
+
+// OutdatedError is returned by `dockerized outdated --exit-code` when versions are outdated.
+type OutdatedError struct {
+	Count int
+}
+
+func (e *OutdatedError) Error() string {
+	if e.Count == 1 {
+		return "1 version is outdated"
+	}
+	return fmt.Sprintf("%d versions are outdated", e.Count)
+}
+
+func (e *OutdatedError) ExitCode() int {
+	return ExitCodeError
+}
+
+// VerifyError is returned by `dockerized verify` when local images don't match dockerized.lock.
+type VerifyError struct {
+	Count int
+}
+
+func (e *VerifyError) Error() string {
+	if e.Count == 1 {
+		return fmt.Sprintf("1 command doesn't match %s", lockFileName)
+	}
+	return fmt.Sprintf("%d commands don't match %s", e.Count, lockFileName)
+}
+
+func (e *VerifyError) ExitCode() int {
+	return ExitCodeError
+}
+
+// UpgradeSkippedError is returned by `dockerized upgrade` when some versions couldn't be upgraded. The other versions
+// are upgraded anyway.
+type UpgradeSkippedError struct {
+	Skipped []SkippedUpgrade
+}
+
+func (e *UpgradeSkippedError) Error() string {
+	var variables []string
+	for _, skipped := range e.Skipped {
+		variables = append(variables, skipped.Variable)
+	}
+	return fmt.Sprintf("cannot upgrade %s", strings.Join(variables, ", "))
+}
+
+func (e *UpgradeSkippedError) ExitCode() int {
+	return ExitCodeError
+}
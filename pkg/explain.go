@@ -0,0 +1,229 @@
+package dockerized
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"sort"
+	"strings"
+)
+
+// Layers that set variables, other than .env files.
+const (
+	LayerEnvironment = "environment"
+	LayerDockerized  = "dockerized"
+)
+
+// VariableSource is a layer that sets a variable.
+type VariableSource struct {
+	// Layer is the .env file that sets the variable, LayerEnvironment or LayerDockerized.
+	Layer string
+	// Line is the line number within the .env file, if any.
+	Line  int
+	Value string
+}
+
+func (s VariableSource) String() string {
+	if s.Line > 0 {
+		return fmt.Sprintf("%s:%d", s.Layer, s.Line)
+	}
+	return s.Layer
+}
+
+// VariableExplanation explains where the effective value of a variable comes from.
+type VariableExplanation struct {
+	Name  string
+	Value string
+	// IsSet is false for variables that are used by services, but not set anywhere.
+	IsSet bool
+	// Source is the layer that sets the effective value.
+	Source VariableSource
+	// Overridden are the layers that also set the variable, from high to low precedence.
+	Overridden []VariableSource
+	// Services are the services that use the variable.
+	Services []string
+}
+
+// ExplainEnvironment explains the variables that are set in .env files, or used by services of rawProject.
+// Variables from environ, the environment dockerized was started with, are only included if they are also set in a
+// .env file, or used by a service.
+func ExplainEnvironment(environ []string, envFiles []EnvFile, env *Environment, rawProject *types.Project) []VariableExplanation {
+	processEnv := NewEnvironment(environ)
+
+	servicesByVariable := map[string][]string{}
+	for _, service := range rawProject.Services {
+		for _, variable := range interpolatedVariables(service) {
+			name := variableName(variable)
+			servicesByVariable[name] = append(servicesByVariable[name], service.Name)
+		}
+	}
+
+	var names []string
+	for _, envFile := range envFiles {
+		for name := range envFile.Variables {
+			names = append(names, name)
+		}
+	}
+	for name := range servicesByVariable {
+		names = append(names, name)
+	}
+	for _, name := range []string{"DOCKERIZED_ROOT", "DOCKERIZED_PROJECT_ROOT"} {
+		if _, ok := env.Lookup(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = unique(names)
+
+	var explanations []VariableExplanation
+	for _, name := range names {
+		// Layers from low to high precedence: .env files, the environment, and variables set by dockerized itself.
+		var sources []VariableSource
+		for _, envFile := range envFiles {
+			if value, ok := envFile.Variables[name]; ok {
+				sources = append(sources, VariableSource{Layer: envFile.Path, Line: envFile.Lines[name], Value: value})
+			}
+		}
+		processValue, inProcessEnv := processEnv.Lookup(name)
+		if inProcessEnv {
+			sources = append(sources, VariableSource{Layer: LayerEnvironment, Value: processValue})
+		}
+		value, isSet := env.Lookup(name)
+		if isSet && isSetByDockerized(name, inProcessEnv) {
+			sources = append(sources, VariableSource{Layer: LayerDockerized, Value: value})
+		}
+
+		explanation := VariableExplanation{
+			Name:     name,
+			Value:    value,
+			IsSet:    isSet,
+			Services: unique(servicesByVariable[name]),
+		}
+		sort.Strings(explanation.Services)
+		if len(sources) > 0 {
+			explanation.Source = sources[len(sources)-1]
+			for i := len(sources) - 2; i >= 0; i-- {
+				explanation.Overridden = append(explanation.Overridden, sources[i])
+			}
+		}
+		explanations = append(explanations, explanation)
+	}
+	return explanations
+}
+
+// interpolatedVariables returns the variables that are interpolated in rawService, e.g. `HOME` in its volumes, and the
+// variables it passes through from the environment. The names of its environment variables are not included, as the
+// container sets them, e.g. `ACCEPT_EULA: "Y"`.
+func interpolatedVariables(rawService types.ServiceConfig) []string {
+	values := []string{rawService.Image}
+	values = append(values, rawService.Entrypoint...)
+	if rawService.Build != nil {
+		values = append(values, rawService.Build.Context, rawService.Build.Dockerfile)
+		for _, value := range rawService.Build.Args {
+			if value != nil {
+				values = append(values, *value)
+			}
+		}
+	}
+	for _, volume := range rawService.Volumes {
+		// Without interpolation, `${HOME:-home}/.aws:/root/.aws` is split at the colon of the default value.
+		values = append(values, volume.Source+":"+volume.Target)
+	}
+	var variables []string
+	for name, value := range rawService.Environment {
+		if value == nil {
+			variables = append(variables, name)
+		} else {
+			values = append(values, *value)
+		}
+	}
+	for _, value := range values {
+		variables = append(variables, ExtractVariablesFromString(value)...)
+	}
+	return variables
+}
+
+// isSetByDockerized returns whether the variable is set by dockerized itself. See NormalizeEnvironment and LoadEnvFiles.
+func isSetByDockerized(name string, inProcessEnv bool) bool {
+	switch name {
+	case "DOCKERIZED_ROOT", "DOCKERIZED_PROJECT_ROOT":
+		return true
+	case "HOME":
+		return !inProcessEnv
+	}
+	return false
+}
+
+// variableName returns the name of a variable reference, without its default value or error message.
+// e.g. `NODE_VERSION:-16` becomes `NODE_VERSION`
+func variableName(reference string) string {
+	if index := strings.IndexAny(reference, ":-?+"); index > 0 {
+		return reference[:index]
+	}
+	return reference
+}
+
+func runEnvCommand(_ context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	explain := flags.Bool("explain", false, "Show where each variable is set, which layers it overrides, and which commands use it.")
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+
+	rawProject, err := getRawProject(meta.ComposeFilePaths)
+	if err != nil {
+		return err
+	}
+	explanations := ExplainEnvironment(meta.Environ, meta.EnvFiles, meta.Env, rawProject)
+
+	if flags.NArg() > 0 {
+		var selected []VariableExplanation
+		for _, name := range flags.Args() {
+			found := false
+			for _, explanation := range explanations {
+				if explanation.Name == name {
+					selected = append(selected, explanation)
+					found = true
+				}
+			}
+			if !found {
+				value, isSet := meta.Env.Lookup(name)
+				explanation := VariableExplanation{Name: name, Value: value, IsSet: isSet}
+				if isSet {
+					explanation.Source = VariableSource{Layer: LayerEnvironment, Value: value}
+				}
+				selected = append(selected, explanation)
+			}
+		}
+		explanations = selected
+	}
+
+	out := meta.Stdout
+	for _, explanation := range explanations {
+		if !*explain {
+			if explanation.IsSet {
+				fmt.Fprintf(out, "%s=%s\n", explanation.Name, explanation.Value)
+			}
+			continue
+		}
+
+		if explanation.IsSet {
+			fmt.Fprintf(out, "%s=%s\n", explanation.Name, explanation.Value)
+			fmt.Fprintf(out, "  set in:     %s\n", explanation.Source)
+		} else {
+			fmt.Fprintf(out, "%s (not set)\n", explanation.Name)
+		}
+		for i, overridden := range explanation.Overridden {
+			label := "overrides:"
+			if i > 0 {
+				label = ""
+			}
+			fmt.Fprintf(out, "  %-11s %s (%s)\n", label, overridden, overridden.Value)
+		}
+		if len(explanation.Services) > 0 {
+			fmt.Fprintf(out, "  used by:    %s\n", strings.Join(explanation.Services, ", "))
+		}
+	}
+	return nil
+}
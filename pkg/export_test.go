@@ -0,0 +1,7 @@
+package dockerized
+
+// Unexported functions, exported for the tests in dockerized_test.
+
+var ReplacePathPrefix = replacePathPrefix
+
+var WriterWithDelay = PathTranslator.writerWithDelay
@@ -0,0 +1,51 @@
+package dockerized
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+)
+
+const serviceExtensionKey = "x-dockerized"
+
+// ServiceExtension contains the dockerized specific settings of a service, defined in the Compose File:
+//
+//	services:
+//	  mssql:
+//	    x-dockerized:
+//	      map_user: false
+//	      versions:
+//	        source: registry
+type ServiceExtension struct {
+	// MapUser can be set to false for images that must run as root, even when user mapping is enabled.
+	MapUser *bool `json:"map_user,omitempty"`
+	// Versions configures where `dockerized <command>:?` finds the versions of the command.
+	Versions VersionsExtension `json:"versions,omitempty"`
+}
+
+type VersionsExtension struct {
+	// Source is the name of a VersionProvider, e.g. dockerhub, registry, npm, pypi, github or goproxy.
+	Source string `json:"source,omitempty"`
+	// Name is the package within the source, e.g. an image, an npm or PyPI package, a GitHub repository (owner/repo)
+	// or a Go module. Defaults to the image for dockerhub and registry, and for pypi to the first package in the
+	// PIP_PACKAGES build argument, or the name of the service.
+	Name string `json:"name,omitempty"`
+}
+
+func GetServiceExtension(service types.ServiceConfig) (ServiceExtension, error) {
+	var extension ServiceExtension
+	value, ok := service.Extensions[serviceExtensionKey]
+	if !ok || value == nil {
+		return extension, nil
+	}
+	// Round-trip through json to map the loosely typed yaml values onto the struct.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return extension, fmt.Errorf("invalid %s in service %s: %w", serviceExtensionKey, service.Name, err)
+	}
+	err = json.Unmarshal(data, &extension)
+	if err != nil {
+		return extension, fmt.Errorf("invalid %s in service %s: %w", serviceExtensionKey, service.Name, err)
+	}
+	return extension, nil
+}
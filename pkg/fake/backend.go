@@ -0,0 +1,108 @@
+// Package fake provides a Backend that records what would be run, without running any containers.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/compose/v2/pkg/api"
+	moby "github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"sync"
+)
+
+// Run is a recorded call to RunOneOffContainer.
+type Run struct {
+	// Service is the final configuration of the service, including the options applied by dockerized.
+	Service types.ServiceConfig
+	Options api.RunOptions
+}
+
+// Build is a recorded call to Build.
+type Build struct {
+	Project string
+	Options api.BuildOptions
+}
+
+// Backend records builds, network setups and runs. It is safe for concurrent use.
+type Backend struct {
+	// ExitCode is returned by RunOneOffContainer.
+	ExitCode int
+	// Err, if set, is returned by every call.
+	Err error
+	// Images are the local images, by reference, returned by InspectImage.
+	Images map[string]moby.ImageInspect
+
+	mutex    sync.Mutex
+	builds   []Build
+	networks []string
+	runs     []Run
+}
+
+func (b *Backend) Build(_ context.Context, project *types.Project, options api.BuildOptions) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.builds = append(b.builds, Build{Project: project.Name, Options: options})
+	return b.Err
+}
+
+func (b *Backend) SetupNetwork(_ context.Context, project *types.Project) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.networks = append(b.networks, project.Name)
+	return b.Err
+}
+
+func (b *Backend) RunOneOffContainer(_ context.Context, project *types.Project, options api.RunOptions) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	service, err := project.GetService(options.Service)
+	if err != nil {
+		return 1, err
+	}
+	b.runs = append(b.runs, Run{Service: service, Options: options})
+	if b.Err != nil {
+		return 1, b.Err
+	}
+	return b.ExitCode, nil
+}
+
+func (b *Backend) InspectImage(_ context.Context, image string) (moby.ImageInspect, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.Err != nil {
+		return moby.ImageInspect{}, b.Err
+	}
+	inspect, ok := b.Images[image]
+	if !ok {
+		return moby.ImageInspect{}, errdefs.NotFound(fmt.Errorf("no such image: %s", image))
+	}
+	return inspect, nil
+}
+
+// Builds returns the recorded builds.
+func (b *Backend) Builds() []Build {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Build{}, b.builds...)
+}
+
+// Networks returns the names of the projects for which the network was set up.
+func (b *Backend) Networks() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string{}, b.networks...)
+}
+
+// Runs returns the recorded runs.
+func (b *Backend) Runs() []Run {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Run{}, b.runs...)
+}
+
+// LastRun returns the most recent run. It panics if nothing was run.
+func (b *Backend) LastRun() Run {
+	runs := b.Runs()
+	return runs[len(runs)-1]
+}
@@ -2,54 +2,79 @@ package help
 
 import (
 	"fmt"
-	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/compose-spec/compose-go/types"
+	"io"
 	"sort"
 )
 
-func Help(composeFilePaths []string) error {
-	project, err := dockerized.GetProject(composeFilePaths)
-	if err != nil {
-		return err
-	}
+// Command is a command of dockerized itself, such as `dockerized env`.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+}
 
-	fmt.Println("Usage: dockerized [options] <command>[:version] [arguments]")
-	fmt.Println("")
-	fmt.Println("Examples:")
-	fmt.Println("  dockerized go")
-	fmt.Println("  dockerized go:1.8 build")
-	fmt.Println("  dockerized --shell go")
-	fmt.Println("  dockerized go:?")
-	fmt.Println("")
+func Help(out io.Writer, project *types.Project, metaCommands []Command) error {
+	fmt.Fprintln(out, "Usage: dockerized [options] <command>[:version] [arguments]")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Examples:")
+	fmt.Fprintln(out, "  dockerized go")
+	fmt.Fprintln(out, "  dockerized go:1.8 build")
+	fmt.Fprintln(out, "  dockerized --shell go")
+	fmt.Fprintln(out, "  dockerized go:?")
+	fmt.Fprintln(out, "")
 
-	fmt.Println("Commands:")
+	fmt.Fprintln(out, "Commands:")
 	services := project.ServiceNames()
 	sort.Strings(services)
 	for _, service := range services {
-		fmt.Printf("  %s\n", service)
+		fmt.Fprintf(out, "  %s\n", service)
+	}
+	fmt.Fprintln(out)
+
+	if len(metaCommands) > 0 {
+		fmt.Fprintln(out, "Dockerized commands:")
+		for _, command := range metaCommands {
+			fmt.Fprintf(out, "  %-30s %s\n", command.Usage, command.Description)
+		}
+		fmt.Fprintln(out)
 	}
-	fmt.Println()
-
-	fmt.Println("Options:")
-	fmt.Println("      --build       Rebuild the container before running it.")
-	fmt.Println("      --pull        Pull the latest version of the container before building it (with --build).")
-	fmt.Println("      --no-cache    Do not use cache when building the container (with --build).")
-	fmt.Println("      --shell       Start a shell inside the command container. Similar to `docker run --entrypoint=sh`.")
-	fmt.Println("      --entrypoint <entrypoint>")
-	fmt.Println("                    Override the default entrypoint of the command container.")
-	fmt.Println("  -p <port>         Exposes given port to host, e.g. -p 8080")
-	fmt.Println("  -p <port>:<port>  Maps host port to container port, e.g. -p 80:8080")
-	fmt.Println("  -v, --verbose     Log what dockerized is doing.")
-	fmt.Println("  -h, --help        Show this help.")
-	fmt.Println()
-
-	fmt.Println("Version:")
-	fmt.Println("  :<version>        The version of the command to run, e.g. 1, 1.8, 1.8.1.")
-	fmt.Println("  :?                List all available versions. E.g. `dockerized go:?`")
-	fmt.Println("  :                 Same as ':?' .")
-	fmt.Println()
-
-	fmt.Println("Arguments:")
-	fmt.Println("  All arguments after <command> are passed to the command itself.")
+
+	fmt.Fprintln(out, "Options:")
+	fmt.Fprintln(out, "      --build       Rebuild the container before running it.")
+	fmt.Fprintln(out, "      --pull        Pull the latest version of the container before building it (with --build).")
+	fmt.Fprintln(out, "      --no-cache    Do not use cache when building the container (with --build).")
+	fmt.Fprintln(out, "      --shell       Start a shell inside the command container. Similar to `docker run --entrypoint=sh`.")
+	fmt.Fprintln(out, "      --entrypoint <entrypoint>")
+	fmt.Fprintln(out, "                    Override the default entrypoint of the command container.")
+	fmt.Fprintln(out, "      --map-user    Run the command as the current host user, so created files are owned by you.")
+	fmt.Fprintln(out, "      --translate-paths")
+	fmt.Fprintln(out, "                    Translate container paths in the output of the command to host paths.")
+	fmt.Fprintln(out, "      --dry-run     Print the resolved service and the equivalent `docker run` command, without running it.")
+	fmt.Fprintln(out, "  -p <port>         Exposes given port to host, e.g. -p 8080")
+	fmt.Fprintln(out, "  -p <port>:<port>  Maps host port to container port, e.g. -p 80:8080")
+	fmt.Fprintln(out, "  -v, --verbose     Log what dockerized is doing.")
+	fmt.Fprintln(out, "  -h, --help        Show this help.")
+	fmt.Fprintln(out, "  --                Run the service named <command>, even if it is a dockerized command, e.g. `dockerized -- init`.")
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "Version:")
+	fmt.Fprintln(out, "  :<version>        The version of the command to run, e.g. 1, 1.8, 1.8.1.")
+	fmt.Fprintln(out, "                    Ranges, e.g. ^1.8 or ~1.8, resolve to the highest matching version.")
+	fmt.Fprintln(out, "  :?                List all available versions. E.g. `dockerized go:?`")
+	fmt.Fprintln(out, "  :                 Same as ':?' .")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "  Options for ':?':")
+	fmt.Fprintln(out, "      --output <format>")
+	fmt.Fprintln(out, "                    Print the versions as plain (default), json or yaml.")
+	fmt.Fprintln(out, "      --limit <n>   Only list the highest n versions.")
+	fmt.Fprintln(out, "      --latest      Only list the highest version.")
+	fmt.Fprintln(out, "      --refresh     List the versions again, instead of using the cache.")
+	fmt.Fprintln(out, "      --offline     Only use cached versions.")
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "Arguments:")
+	fmt.Fprintln(out, "  All arguments after <command> are passed to the command itself.")
 
 	return nil
 }
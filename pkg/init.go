@@ -0,0 +1,180 @@
+package dockerized
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// initOptions are the options of `dockerized init`.
+type initOptions struct {
+	// ComposeFileName is the name of the Compose File of the project, which is loaded by its dockerized.env.
+	ComposeFileName string
+	// Versions are the version variables to pin, e.g. NODE_VERSION=17.7.2, in order.
+	Versions []string
+	// VersionFiles are the names of the version files of other tools that were found in the project, e.g. .nvmrc.
+	VersionFiles []string
+}
+
+// projectEnvFileContent returns the content of a new dockerized.env, which loads the Compose File of the project in
+// addition to the default commands.
+func projectEnvFileContent(options initOptions) string {
+	var content strings.Builder
+	content.WriteString("# Settings of dockerized for this directory and its subdirectories.\n")
+	content.WriteString("# See https://github.com/datastack-net/dockerized\n\n")
+	content.WriteString("# Load the commands of this project, in addition to the default commands.\n")
+	fmt.Fprintf(&content, "COMPOSE_FILE=\"${COMPOSE_FILE};${DOCKERIZED_PROJECT_ROOT}/%s\"\n", options.ComposeFileName)
+	if len(options.VersionFiles) > 0 {
+		fmt.Fprintf(&content, "\n# Use the versions in %s.\n", strings.Join(options.VersionFiles, ", "))
+		content.WriteString("DOCKERIZED_VERSION_FILES=true\n")
+	}
+	if len(options.Versions) > 0 {
+		content.WriteString("\n# Versions\n")
+		for _, pinned := range options.Versions {
+			content.WriteString(pinned + "\n")
+		}
+	}
+	return content.String()
+}
+
+// projectComposeFileContent is the content of a new Compose File of a project.
+const projectComposeFileContent = `# Commands of this project, in addition to the default commands of dockerized.
+# See https://github.com/datastack-net/dockerized#adding-custom-commands
+services: {}
+`
+
+// defaultVersions returns the version variables used by the commands, set to their default version in the bundled .env.
+// Versions that are set by version files are skipped, and returned separately.
+//
+// Partial defaults, e.g. PYTHON_VERSION=3.10, are resolved to the highest matching version, so the project is pinned to
+// an exact version. If that fails, the default is pinned as is, with a warning.
+func defaultVersions(ctx context.Context, meta *metaContext, commandNames []string, versionEnvFiles []EnvFile) (versions []string, skipped []string, warnings []string, err error) {
+	var defaultEnvFile *EnvFile
+	for i := range meta.EnvFiles {
+		if meta.EnvFiles[i].Path == filepath.Join(meta.Root, ".env") {
+			defaultEnvFile = &meta.EnvFiles[i]
+		}
+	}
+	if defaultEnvFile == nil {
+		return nil, nil, nil, fmt.Errorf("default .env not found in %s", meta.Root)
+	}
+	rawProject, err := getRawProject(meta.ComposeFilePaths)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var variables []string
+	for _, commandName := range commandNames {
+		rawService, err := rawProject.GetService(commandName)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// Commands such as npm use the version of another command, e.g. NODE_VERSION.
+		var serviceVariables []string
+		for _, variable := range ExtractVariables(rawService) {
+			if variable = variableName(variable); strings.HasSuffix(variable, "_VERSION") {
+				serviceVariables = append(serviceVariables, variable)
+			}
+		}
+		if len(serviceVariables) == 0 {
+			return nil, nil, nil, &UnsupportedVersionSelectionError{Command: commandName}
+		}
+		variables = append(variables, serviceVariables...)
+	}
+
+	for _, variable := range unique(variables) {
+		versionFile := ""
+		for _, versionEnvFile := range versionEnvFiles {
+			if _, ok := versionEnvFile.Variables[variable]; ok {
+				versionFile = filepath.Base(versionEnvFile.Path)
+			}
+		}
+		if versionFile != "" {
+			skipped = append(skipped, fmt.Sprintf("%s is set by %s", variable, versionFile))
+			continue
+		}
+		value, ok := defaultEnvFile.Variables[variable]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("%s has no default version in %s", variable, defaultEnvFile.Path)
+		}
+		if IsPartialVersion(value) {
+			resolved, err := resolveDefaultVersion(ctx, meta, rawProject, variable, value)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("cannot resolve %s=%s, pinned as is: %s", variable, value, err))
+			} else {
+				value = resolved
+			}
+		}
+		versions = append(versions, variable+"="+value)
+	}
+	return versions, skipped, warnings, nil
+}
+
+// resolveDefaultVersion returns the highest version that matches the partial default version of variable.
+func resolveDefaultVersion(ctx context.Context, meta *metaContext, rawProject *types.Project, variable string, value string) (string, error) {
+	service, ok := findVersionService(rawProject, variable)
+	if !ok {
+		return "", fmt.Errorf("no command uses %s as its version", variable)
+	}
+	return meta.Resolver.Resolve(ctx, meta.ComposeFilePaths, meta.Env, service.Name, variable, value)
+}
+
+func runInitCommand(ctx context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	force := flags.Bool("force", false, "Overwrite existing files.")
+	composeFileName := flags.String("compose-file", "docker-compose.yml", "The name of the Compose File of the project.")
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+
+	envFilePath := filepath.Join(meta.Dir, dockerizedEnvFileName)
+	composeFilePath := filepath.Join(meta.Dir, *composeFileName)
+	if !*force {
+		for _, path := range []string{envFilePath, composeFilePath} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	versionEnvFiles, err := readVersionFiles(meta.Dir, filepath.Join(meta.Root, ".env"))
+	if err != nil {
+		return err
+	}
+	options := initOptions{ComposeFileName: *composeFileName}
+	for _, versionEnvFile := range versionEnvFiles {
+		options.VersionFiles = append(options.VersionFiles, filepath.Base(versionEnvFile.Path))
+	}
+	var skipped, warnings []string
+	options.Versions, skipped, warnings, err = defaultVersions(ctx, meta, flags.Args(), versionEnvFiles)
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(envFilePath, []byte(projectEnvFileContent(options)), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(meta.Stdout, "Created %s\n", envFilePath)
+	if err = os.WriteFile(composeFilePath, []byte(projectComposeFileContent), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(meta.Stdout, "Created %s\n", composeFilePath)
+	if len(options.VersionFiles) > 0 {
+		fmt.Fprintf(meta.Stdout, "Using versions from %s\n", strings.Join(options.VersionFiles, ", "))
+	}
+	for _, reason := range skipped {
+		fmt.Fprintf(meta.Stderr, "Not pinned: %s\n", reason)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(meta.Stderr, "Warning: %s\n", warning)
+	}
+	return nil
+}
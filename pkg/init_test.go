@@ -0,0 +1,120 @@
+package dockerized_test
+
+import (
+	"bytes"
+	"errors"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dockerHubConfig returns the Config to run dockerized with runFake, listing the versions of images on Docker Hub with
+// provider.
+func dockerHubConfig(provider dockerized.VersionProvider) dockerized.Config {
+	return dockerized.Config{VersionProviders: dockerized.VersionProviders{dockerized.VersionSourceDockerHub: provider}}
+}
+
+func TestInit(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	provider := &countingVersionProvider{versions: []string{"3.9.12", "3.10.2", "3.10.4", "3.10.4-slim", "3.11.0a7", "latest"}}
+	_, output, err, _ := runFake(t, dir, dockerHubConfig(provider), "init", "node", "npm", "python")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Created "+filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, output, "Created "+filepath.Join(dir, "docker-compose.yml"))
+	assert.NotContains(t, output, "Warning")
+
+	// The partial default of python is pinned to an exact version.
+	envFile, _ := os.ReadFile(filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, string(envFile), "COMPOSE_FILE=\"${COMPOSE_FILE};${DOCKERIZED_PROJECT_ROOT}/docker-compose.yml\"\n")
+	assert.Contains(t, string(envFile), "\n# Versions\nNODE_VERSION=17.7.2\nPYTHON_VERSION=3.10.4\n")
+	assert.NotContains(t, string(envFile), "DOCKERIZED_VERSION_FILES")
+	assert.Equal(t, int32(1), provider.calls)
+
+	// The project loads, with the default commands and the commands of the project.
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services:\n  hello:\n    image: hello-world\n"), 0644))
+	for command, image := range map[string]string{"node": "node:17.7.2", "python": "python:3.10.4", "hello": "hello-world"} {
+		backend, _, err, _ := runFake(t, dir, dockerHubConfig(provider), command, "--version")
+		assert.Nil(t, err, command)
+		assert.Equal(t, image, backend.LastRun().Service.Image, command)
+	}
+	// Running the pinned commands doesn't list versions.
+	assert.Equal(t, int32(1), provider.calls)
+}
+
+func TestInitPinsPartialDefaultIfVersionsCannotBeListed(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	config := dockerHubConfig(&countingVersionProvider{err: errors.New("no network")})
+	var stdout bytes.Buffer
+	config.Stdout = &stdout
+	_, stderr, err, _ := runFake(t, dir, config, "init", "python")
+	assert.Nil(t, err)
+	assert.Equal(t, "Warning: cannot resolve PYTHON_VERSION=3.10, pinned as is: no network\n", stderr)
+	assert.Contains(t, stdout.String(), "Created ")
+	envFile, _ := os.ReadFile(filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, string(envFile), "\nPYTHON_VERSION=3.10\n")
+}
+
+func TestInitEmptyComposeFileLoads(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, _, err, _ := runFake(t, dir, dockerized.Config{}, "init")
+	assert.Nil(t, err)
+	backend, _, err, _ := runFake(t, dir, dockerized.Config{}, "go", "version")
+	assert.Nil(t, err)
+	assert.Equal(t, "golang:1.17.8", backend.LastRun().Service.Image)
+}
+
+func TestInitRefusesToOverwrite(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}\n"), 0644))
+	_, _, err, exitCode := runFake(t, dir, dockerized.Config{}, "init")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, err.Error(), "use --force to overwrite it")
+	_, err = os.Stat(filepath.Join(dir, "dockerized.env"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, _, err, _ = runFake(t, dir, dockerized.Config{}, "init", "--compose-file", "dockerized.yml")
+	assert.Nil(t, err)
+	envFile, _ := os.ReadFile(filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, string(envFile), "${DOCKERIZED_PROJECT_ROOT}/dockerized.yml\"")
+
+	_, _, err, _ = runFake(t, dir, dockerized.Config{}, "init", "--force", "go")
+	assert.Nil(t, err)
+	envFile, _ = os.ReadFile(filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, string(envFile), "GO_VERSION=1.17.8\n")
+}
+
+func TestInitDetectsVersionFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".nvmrc"), []byte("18.2.0\n"), 0644))
+	var stdout bytes.Buffer
+	_, stderr, err, _ := runFake(t, dir, dockerized.Config{Stdout: &stdout}, "init", "node", "go")
+	assert.Nil(t, err)
+	assert.Equal(t, "Not pinned: NODE_VERSION is set by .nvmrc\n", stderr)
+	assert.NotContains(t, stdout.String(), "Not pinned")
+
+	envFile, _ := os.ReadFile(filepath.Join(dir, "dockerized.env"))
+	assert.Contains(t, string(envFile), "\n# Use the versions in .nvmrc.\nDOCKERIZED_VERSION_FILES=true\n")
+	assert.NotContains(t, string(envFile), "NODE_VERSION")
+	assert.Contains(t, string(envFile), "GO_VERSION=1.17.8\n")
+
+	backend, _, err, _ := runFake(t, dir, dockerized.Config{}, "node")
+	assert.Nil(t, err)
+	assert.Equal(t, "node:18.2.0", backend.LastRun().Service.Image)
+}
+
+func TestInitUnknownCommand(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, _, err, _ := runFake(t, dir, dockerized.Config{}, "init", "unknown-command")
+	assert.NotNil(t, err)
+	_, statErr := os.Stat(filepath.Join(dir, "dockerized.env"))
+	assert.True(t, os.IsNotExist(statErr))
+}
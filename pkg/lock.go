@@ -0,0 +1,415 @@
+package dockerized
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerignore"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var lockFileName = "dockerized.lock"
+
+// LabelBuildHash is the label of the images built by dockerized, with the hash of their build inputs.
+const LabelBuildHash = "net.datastack.dockerized.build-hash"
+
+// lockFileVersion is the version of the format of dockerized.lock.
+const lockFileVersion = 1
+
+// LockFile pins the images of the commands of a project to a digest, so everyone runs the same image, even if its tag
+// is pushed again.
+type LockFile struct {
+	Version  int                  `json:"version"`
+	Services map[string]LockEntry `json:"services"`
+}
+
+// LockEntry is the locked image of a service.
+type LockEntry struct {
+	// Image is the image of the service when it was locked, e.g. node:17.7.2.
+	Image string `json:"image"`
+	// Digest is the digest of the image in its registry, e.g. sha256:...
+	Digest string `json:"digest,omitempty"`
+	// BuildHash is the hash of the build inputs of a service that is built locally, instead of pulled.
+	BuildHash string `json:"build_hash,omitempty"`
+}
+
+// projectLockFilePath returns the path of dockerized.lock, next to the dockerized.env of the project.
+func projectLockFilePath(env *Environment) string {
+	projectRoot := env.Get("DOCKERIZED_PROJECT_ROOT")
+	if projectRoot == "" {
+		return ""
+	}
+	return filepath.Join(projectRoot, lockFileName)
+}
+
+// ReadLockFile reads the lock file at path. If it doesn't exist, nil is returned.
+func ReadLockFile(path string) (*LockFile, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lockFile LockFile
+	if err = json.Unmarshal(content, &lockFile); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &lockFile, nil
+}
+
+// Entry returns the lock entry of the service. A nil lock file has no entries.
+func (l *LockFile) Entry(serviceName string) (LockEntry, bool) {
+	if l == nil {
+		return LockEntry{}, false
+	}
+	entry, ok := l.Services[serviceName]
+	return entry, ok
+}
+
+// WriteLockFile writes lockFile to path, with its services sorted by name.
+func WriteLockFile(path string, lockFile *LockFile) error {
+	content, err := json.MarshalIndent(lockFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// LockService returns the lock entry of service: the digest of its image, or the hash of its build inputs if it is
+// built locally.
+func LockService(ctx context.Context, service types.ServiceConfig, env *Environment) (LockEntry, error) {
+	entry := LockEntry{Image: service.Image}
+	if service.Build != nil {
+		buildHash, err := BuildInputHash(*service.Build)
+		if err != nil {
+			return entry, fmt.Errorf("cannot lock %s: %w", service.Name, err)
+		}
+		entry.BuildHash = buildHash
+		return entry, nil
+	}
+	digest, err := ImageDigest(ctx, service.Image, env)
+	if err != nil {
+		return entry, fmt.Errorf("cannot lock %s: %w", service.Name, err)
+	}
+	entry.Digest = digest
+	return entry, nil
+}
+
+// ImageDigest returns the digest of image in its registry. The credentials of `docker login` are used for private
+// registries.
+func ImageDigest(ctx context.Context, image string, env *Environment) (string, error) {
+	ref, err := reference.ParseDockerRef(image)
+	if err != nil {
+		return "", err
+	}
+	if digested, ok := ref.(reference.Digested); ok {
+		return digested.Digest().String(), nil
+	}
+	tagged, ok := ref.(reference.Tagged)
+	if !ok {
+		return "", fmt.Errorf("image %s has no tag", image)
+	}
+	registryClient := NewRegistryClient(DockerCredentials(env))
+	return registryClient.GetDigest(ctx, registryHost(ref), reference.Path(ref), tagged.Tag())
+}
+
+// registryHost returns the host of the registry of ref, using the registry of Docker Hub for docker.io.
+func registryHost(ref reference.Named) string {
+	host := reference.Domain(ref)
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	return host
+}
+
+// BuildInputHash returns a hash of everything that determines the image of a build: the files in the build context,
+// the Dockerfile, the build arguments and the target. Files excluded by the .dockerignore of the context are skipped,
+// as they are not sent to the build.
+func BuildInputHash(build types.BuildConfig) (string, error) {
+	hash := sha256.New()
+
+	ignored, err := readDockerignore(build.Context)
+	if err != nil {
+		return "", err
+	}
+
+	dockerfile := build.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(build.Context, dockerfile)
+	}
+	content, err := os.ReadFile(dockerfile)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(hash, "dockerfile\x00%x\x00", sha256.Sum256(content))
+
+	err = filepath.WalkDir(build.Context, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		relativePath, err := filepath.Rel(build.Context, path)
+		if err != nil {
+			return err
+		}
+		if relativePath != "." {
+			isIgnored, err := ignored.MatchesOrParentMatches(relativePath)
+			if err != nil {
+				return err
+			}
+			if isIgnored {
+				// Files in an ignored directory may still be included by an exclusion, e.g. `!dist/keep`.
+				if entry.IsDir() && !ignored.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "file\x00%s\x00%x\x00", filepath.ToSlash(relativePath), sha256.Sum256(content))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var args []string
+	for name, value := range build.Args {
+		if value == nil {
+			args = append(args, name)
+		} else {
+			args = append(args, name+"="+*value)
+		}
+	}
+	sort.Strings(args)
+	for _, arg := range args {
+		fmt.Fprintf(hash, "arg\x00%s\x00", arg)
+	}
+	fmt.Fprintf(hash, "target\x00%s\x00", build.Target)
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readDockerignore returns the patterns of the .dockerignore in the build context, if any.
+func readDockerignore(contextDir string) (*fileutils.PatternMatcher, error) {
+	file, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileutils.NewPatternMatcher(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	patterns, err := dockerignore.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return fileutils.NewPatternMatcher(patterns)
+}
+
+// labelBuildInputs labels the image of the service with the hash of its build inputs, if it is built locally, so
+// `dockerized verify` can tell which inputs a local image was built from.
+//
+// Hashing a large build context takes a while, so it's only done if the image is built: with force, e.g. for --build,
+// or because the image doesn't exist yet.
+func labelBuildInputs(ctx context.Context, backend Backend, project *types.Project, serviceName string, force bool) {
+	for _, service := range project.Services {
+		if service.Name != serviceName || service.Build == nil {
+			continue
+		}
+		if !force && hasLocalImage(ctx, backend, project, service) {
+			continue
+		}
+		buildHash, err := BuildInputHash(*service.Build)
+		if err != nil {
+			// The build itself reports what's wrong.
+			continue
+		}
+		if service.Build.Labels == nil {
+			service.Build.Labels = types.Labels{}
+		}
+		service.Build.Labels[LabelBuildHash] = buildHash
+	}
+}
+
+// hasLocalImage returns whether the image of a service that is built locally exists, so it won't be built when it runs.
+func hasLocalImage(ctx context.Context, backend Backend, project *types.Project, service types.ServiceConfig) bool {
+	_, err := backend.InspectImage(ctx, builtImageName(project, service))
+	return err == nil
+}
+
+// builtImageName returns the name of the image that is built for service.
+func builtImageName(project *types.Project, service types.ServiceConfig) string {
+	if service.Image == "" {
+		// The name Docker Compose gives to built images.
+		return project.Name + "_" + service.Name
+	}
+	return service.Image
+}
+
+// buildHashOf returns the hash of the build inputs, using the label set by labelBuildInputs if possible.
+func buildHashOf(build types.BuildConfig) (string, error) {
+	if buildHash, ok := build.Labels[LabelBuildHash]; ok {
+		return buildHash, nil
+	}
+	return BuildInputHash(build)
+}
+
+// LockedImage runs the image of the service by the digest in entry. If the configured image is not the locked image,
+// or the build inputs changed, a warning is written and the service runs as configured.
+func LockedImage(entry LockEntry, warnings io.Writer) func(config *types.ServiceConfig) error {
+	return func(config *types.ServiceConfig) error {
+		if entry.Image != config.Image {
+			fmt.Fprintf(warnings, "Warning: %s is locked to %s, but %s is configured. Run `dockerized lock %s` to update %s.\n",
+				config.Name, entry.Image, config.Image, config.Name, lockFileName)
+			return nil
+		}
+		if config.Build != nil {
+			if buildHash, err := buildHashOf(*config.Build); err != nil || buildHash != entry.BuildHash {
+				fmt.Fprintf(warnings, "Warning: the build of %s changed since it was locked. Run `dockerized lock %s` to update %s.\n",
+					config.Name, config.Name, lockFileName)
+			}
+			return nil
+		}
+		if entry.Digest != "" && !strings.Contains(config.Image, "@") {
+			config.Image = config.Image + "@" + entry.Digest
+		}
+		return nil
+	}
+}
+
+// lockedServiceNames returns the services of the project: those defined in a compose file of the project, and those
+// whose version is set in the dockerized.env of the project.
+func lockedServiceNames(rawProject *types.Project, composeFilePaths []string, projectEnvFile EnvFile) ([]string, error) {
+	projectRoot := filepath.Dir(projectEnvFile.Path)
+	var projectComposeFilePaths []string
+	for _, composeFilePath := range composeFilePaths {
+		if isSubPath(projectRoot, composeFilePath) {
+			projectComposeFilePaths = append(projectComposeFilePaths, composeFilePath)
+		}
+	}
+
+	var names []string
+	if len(projectComposeFilePaths) > 0 {
+		projectServices, err := getRawProject(projectComposeFilePaths)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, projectServices.ServiceNames()...)
+	}
+	for variable := range projectEnvFile.Variables {
+		if service, ok := findVersionService(rawProject, variable); ok {
+			names = append(names, service.Name)
+		}
+	}
+	sort.Strings(names)
+	return unique(names), nil
+}
+
+func isSubPath(parent string, path string) bool {
+	relativePath, err := filepath.Rel(parent, path)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// findProjectLockFile returns the dockerized.env of the project, and the path of the dockerized.lock next to it.
+// The global dockerized.env is not a project, so it has no lock file.
+func findProjectLockFile(meta *metaContext) (EnvFile, string, error) {
+	projectEnvFilePath, err := findProjectEnvFileBelowHome(meta.Dir, meta.Env.HomeDir())
+	if err != nil {
+		return EnvFile{}, "", err
+	}
+	projectEnvFile := EnvFile{Path: projectEnvFilePath}
+	for _, envFile := range meta.EnvFiles {
+		if envFile.Path == projectEnvFilePath {
+			projectEnvFile = envFile
+		}
+	}
+	return projectEnvFile, filepath.Join(filepath.Dir(projectEnvFilePath), lockFileName), nil
+}
+
+func runLockCommand(ctx context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+
+	projectEnvFile, lockFilePath, err := findProjectLockFile(meta)
+	if err != nil {
+		return fmt.Errorf("cannot lock: %w", err)
+	}
+
+	rawProject, err := getRawProject(meta.ComposeFilePaths)
+	if err != nil {
+		return err
+	}
+	project, err := meta.GetProject()
+	if err != nil {
+		return err
+	}
+
+	// Locking specific commands keeps the other entries.
+	lockFile := &LockFile{Services: map[string]LockEntry{}}
+	names := flags.Args()
+	if len(names) > 0 {
+		existing, err := ReadLockFile(lockFilePath)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Services != nil {
+			lockFile = existing
+		}
+	} else {
+		names, err = lockedServiceNames(rawProject, meta.ComposeFilePaths, projectEnvFile)
+		if err != nil {
+			return err
+		}
+	}
+	lockFile.Version = lockFileVersion
+
+	for _, name := range names {
+		service, err := project.GetService(name)
+		if err != nil {
+			return err
+		}
+		entry, err := LockService(ctx, service, meta.Env)
+		if err != nil {
+			return err
+		}
+		lockFile.Services[name] = entry
+		if entry.Digest != "" {
+			fmt.Fprintf(meta.Stdout, "%s: %s@%s\n", name, entry.Image, entry.Digest)
+		} else {
+			fmt.Fprintf(meta.Stdout, "%s: %s (build %s)\n", name, entry.Image, entry.BuildHash)
+		}
+	}
+
+	if err = WriteLockFile(lockFilePath, lockFile); err != nil {
+		return err
+	}
+	fmt.Fprintf(meta.Stdout, "Locked %s\n", lockFilePath)
+	return nil
+}
@@ -0,0 +1,185 @@
+package dockerized_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/datastack-net/dockerized/pkg/fake"
+	moby "github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newLockProject writes a project with a dockerized.env, an image from a test registry and a service that is built
+// locally. It returns the project directory and a home directory with the credentials of the registry.
+func newLockProject(t *testing.T) (string, string) {
+	server := newTestRegistry(t, []string{"1.0.0", "1.1.0"}, 10)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	home := t.TempDir()
+	dockerConfig := fmt.Sprintf(`{"auths": {"%s": {"auth": "%s"}}}`, host, base64.StdEncoding.EncodeToString([]byte("user:secret")))
+	assert.Nil(t, os.MkdirAll(filepath.Join(home, ".docker"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(home, ".docker", "config.json"), []byte(dockerConfig), 0644))
+
+	dir := t.TempDir()
+	compose := fmt.Sprintf(`services:
+  app:
+    image: "%s/library/app:${APP_VERSION}"
+  tool:
+    image: "tool:${TOOL_VERSION}"
+    build:
+      context: ./tool
+      args:
+        TOOL_VERSION: "${TOOL_VERSION}"
+`, host)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(compose), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("APP_VERSION=1.0.0\nTOOL_VERSION=1.0\n"), 0644))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "tool"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tool", "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	return dir, home
+}
+
+// lockConfig returns the Config to run the project of newLockProject with runFake.
+func lockConfig(dir string, home string, env ...string) dockerized.Config {
+	return dockerized.Config{Env: append([]string{"HOME=" + home, "COMPOSE_FILE=" + filepath.Join(dir, "docker-compose.yml")}, env...)}
+}
+
+func TestLock(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, output, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Locked "+filepath.Join(dir, "dockerized.lock"))
+
+	lockFile, err := dockerized.ReadLockFile(filepath.Join(dir, "dockerized.lock"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, lockFile.Version)
+	assert.Equal(t, testDigest("1.0.0"), lockFile.Services["app"].Digest)
+	assert.True(t, strings.HasSuffix(lockFile.Services["app"].Image, "/library/app:1.0.0"))
+	assert.Equal(t, "tool:1.0", lockFile.Services["tool"].Image)
+	assert.True(t, strings.HasPrefix(lockFile.Services["tool"].BuildHash, "sha256:"))
+	assert.Empty(t, lockFile.Services["tool"].Digest)
+}
+
+func TestRunUsesLockedDigest(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+
+	backend, output, err, _ := runFake(t, dir, lockConfig(dir, home), "app")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(backend.LastRun().Service.Image, "/library/app:1.0.0@"+testDigest("1.0.0")))
+	assert.NotContains(t, output, "Warning")
+
+	backend, output, err, _ = runFake(t, dir, lockConfig(dir, home), "tool")
+	assert.Nil(t, err)
+	assert.Equal(t, "tool:1.0", backend.LastRun().Service.Image)
+	assert.NotContains(t, output, "Warning")
+}
+
+func TestRunWarnsOnLockDrift(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+
+	backend, output, err, _ := runFake(t, dir, lockConfig(dir, home, "APP_VERSION=1.1.0"), "app")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(backend.LastRun().Service.Image, "/library/app:1.1.0"))
+	assert.Contains(t, output, "Warning: app is locked to")
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tool", "Dockerfile"), []byte("FROM alpine:3.15\n"), 0644))
+	_, output, err, _ = runFake(t, dir, lockConfig(dir, home), "tool")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Warning: the build of tool changed")
+}
+
+func TestLockCommandKeepsOtherEntries(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("APP_VERSION=1.1.0\nTOOL_VERSION=1.0\n"), 0644))
+	_, output, err, _ := runFake(t, dir, lockConfig(dir, home), "lock", "app")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "app: ")
+	assert.NotContains(t, output, "tool: ")
+
+	lockFile, err := dockerized.ReadLockFile(filepath.Join(dir, "dockerized.lock"))
+	assert.Nil(t, err)
+	assert.Equal(t, testDigest("1.1.0"), lockFile.Services["app"].Digest)
+	assert.Equal(t, "tool:1.0", lockFile.Services["tool"].Image)
+}
+
+func TestLockWithoutProject(t *testing.T) {
+	dir, home := newLockProject(t)
+	assert.Nil(t, os.Remove(filepath.Join(dir, "dockerized.env")))
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home, "APP_VERSION=1.0.0", "TOOL_VERSION=1.0"), "lock")
+	assert.EqualError(t, err, "cannot lock: no project dockerized.env found")
+
+	// The dockerized.env in the home directory is the global one, not a project.
+	dir = filepath.Join(home, "src")
+	assert.Nil(t, os.Mkdir(dir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(home, "dockerized.env"), []byte("APP_VERSION=1.0.0\nTOOL_VERSION=1.0\n"), 0644))
+	_, _, err, _ = runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.EqualError(t, err, "cannot lock: no project dockerized.env found")
+	assert.NoFileExists(t, filepath.Join(home, "dockerized.lock"))
+}
+
+func TestBuildInputHashSkipsDockerignoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":         "FROM alpine\n",
+		".dockerignore":      "node_modules\n*.log\n",
+		"main.go":            "package main\n",
+		"debug.log":          "started\n",
+		"node_modules/a.js":  "a\n",
+		"src/node_modules/b": "b\n",
+	}
+	for name, content := range files {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	build := types.BuildConfig{Context: dir}
+	hash, err := dockerized.BuildInputHash(build)
+	assert.Nil(t, err)
+
+	// Ignored files don't change the hash.
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "debug.log"), []byte("stopped\n"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "node_modules", "a.js"), []byte("changed\n"), 0644))
+	ignoredHash, err := dockerized.BuildInputHash(build)
+	assert.Nil(t, err)
+	assert.Equal(t, hash, ignoredHash)
+
+	// Other files do, including those only ignored in another directory.
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "src", "node_modules", "b"), []byte("changed\n"), 0644))
+	changedHash, err := dockerized.BuildInputHash(build)
+	assert.Nil(t, err)
+	assert.NotEqual(t, hash, changedHash)
+}
+
+func TestRunLabelsOnlyImagesThatAreBuilt(t *testing.T) {
+	dir, home := newLockProject(t)
+	images := map[string]moby.ImageInspect{"tool:1.0": {ID: "sha256:tool"}}
+
+	// The image exists, and there's no dockerized.lock: the build context isn't hashed.
+	backend, _, err, _ := runFake(t, dir, verifyConfig(dir, home, &fake.Backend{Images: images}), "tool")
+	assert.Nil(t, err)
+	assert.NotContains(t, backend.LastRun().Service.Build.Labels, dockerized.LabelBuildHash)
+
+	// The image is built, because it's missing or with --build.
+	backend, _, err, _ = runFake(t, dir, lockConfig(dir, home), "tool")
+	assert.Nil(t, err)
+	assert.Contains(t, backend.LastRun().Service.Build.Labels, dockerized.LabelBuildHash)
+	backend, _, err, _ = runFake(t, dir, verifyConfig(dir, home, &fake.Backend{Images: images}), "--build", "tool")
+	assert.Nil(t, err)
+	assert.Contains(t, backend.LastRun().Service.Build.Labels, dockerized.LabelBuildHash)
+
+	// A dry run doesn't hash the build context.
+	_, output, err, _ := runFake(t, dir, lockConfig(dir, home), "--dry-run", "--build", "tool")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "# Build")
+	assert.NotContains(t, output, dockerized.LabelBuildHash)
+}
@@ -0,0 +1,138 @@
+package dockerized
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/datastack-net/dockerized/pkg/help"
+	"io"
+	"sort"
+)
+
+// metaCommand is a command of dockerized itself, instead of a command that runs in a container.
+// Meta commands take precedence over services with the same name, which can still be run with `dockerized -- <name>`.
+type metaCommand struct {
+	Usage       string
+	Description string
+	Run         func(ctx context.Context, meta *metaContext, args []string) error
+}
+
+// metaContext is the state of dockerized that is available to meta commands.
+type metaContext struct {
+	Name    string
+	Command metaCommand
+	Stdout  io.Writer
+	// Stderr is for warnings, so they don't mix with the output of the command.
+	Stderr io.Writer
+	// Environ is the environment dockerized was started with, before loading any .env files.
+	Environ          []string
+	Env              *Environment
+	EnvFiles         []EnvFile
+	ComposeFilePaths []string
+	Root             string
+	Dir              string
+	Verbose          bool
+	// Resolver lists the versions of commands, using the version cache.
+	Resolver *VersionResolver
+	// NewBackend connects to Docker. Most meta commands don't need it, so it's only connected when needed.
+	NewBackend func() (Backend, error)
+}
+
+// GetProject loads the Compose project.
+func (m *metaContext) GetProject() (*types.Project, error) {
+	return GetProject(m.ComposeFilePaths, m.Env)
+}
+
+var metaCommands = map[string]metaCommand{
+	"add": {
+		Usage:       "add [--global] [--force] --image image [--entrypoint command] [--version-var name] [--version version] [--mount source:target]... name",
+		Description: "Add a command that runs the image to the Compose File of the project, or the global one.",
+		Run:         runAddCommand,
+	},
+	"env": {
+		Usage:       "env [--explain] [variable...]",
+		Description: "List the effective variables, and where they are set.",
+		Run:         runEnvCommand,
+	},
+	"init": {
+		Usage:       "init [--force] [--compose-file name] [command...]",
+		Description: "Create a dockerized.env and Compose File for the project in the current directory, pinning the default versions of the commands.",
+		Run:         runInitCommand,
+	},
+	"lock": {
+		Usage:       "lock [command...]",
+		Description: "Lock the images of the project's commands to their digest, in dockerized.lock.",
+		Run:         runLockCommand,
+	},
+	"outdated": {
+		Usage:       "outdated [--all] [--output format] [--exit-code] [command...]",
+		Description: "List the configured versions that are older than the latest available version.",
+		Run:         runOutdatedCommand,
+	},
+	"upgrade": {
+		Usage:       "upgrade [--global] [--policy patch|minor|major] [--dry-run] [command...]",
+		Description: "Upgrade the versions in the project or global dockerized.env file.",
+		Run:         runUpgradeCommand,
+	},
+	"verify": {
+		Usage:       "verify [command...]",
+		Description: "Verify that the local images of the project's commands match dockerized.lock.",
+		Run:         runVerifyCommand,
+	},
+}
+
+func getMetaCommand(name string) (metaCommand, bool) {
+	command, ok := metaCommands[name]
+	return command, ok
+}
+
+// metaCommandHelp lists the meta commands, for help.Help.
+func metaCommandHelp() []help.Command {
+	var commands []help.Command
+	for name, command := range metaCommands {
+		commands = append(commands, help.Command{
+			Name:        name,
+			Usage:       command.Usage,
+			Description: command.Description,
+		})
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// errMetaHelp is returned by parseMetaFlags when the help of a meta command is shown.
+var errMetaHelp = errors.New("help requested")
+
+// parseMetaFlags parses the arguments of a meta command. Its usage is printed for -h and --help.
+func parseMetaFlags(meta *metaContext, flags *flag.FlagSet, args []string) error {
+	command := meta.Command
+	out := meta.Stdout
+	flags.SetOutput(io.Discard)
+	flags.Usage = func() {}
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(out, "Usage: dockerized %s\n\n%s\n", command.Usage, command.Description)
+		if hasFlags(flags) {
+			fmt.Fprintf(out, "\nOptions:\n")
+			flags.SetOutput(out)
+			flags.PrintDefaults()
+		}
+		return errMetaHelp
+	}
+	if err != nil {
+		return &UsageError{Message: fmt.Sprintf("%s\nUsage: dockerized %s", err, command.Usage)}
+	}
+	return nil
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	flags.VisitAll(func(*flag.Flag) {
+		found = true
+	})
+	return found
+}
@@ -0,0 +1,84 @@
+package dockerized
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const containerHostRoot = "/host"
+
+// HostMount is the host directory that is mounted into the command container.
+type HostMount struct {
+	HostPath      string
+	ContainerPath string
+}
+
+// GetHostMount determines which host directory to mount for a command executed in hostCwd, and the matching
+// working directory inside the container.
+//
+// The project root is mounted when there is one, so commands can access parent directories within the project
+// (e.g. `dockerized tree ../dir`). Otherwise, only hostCwd is mounted.
+func GetHostMount(hostCwd string, homeDir string) (mount HostMount, containerCwd string) {
+	hostRoot := GetProjectRoot(hostCwd, homeDir)
+	if hostRoot == "" {
+		hostRoot = hostCwd
+	}
+
+	mount = HostMount{
+		HostPath:      hostRoot,
+		ContainerPath: containerMountPath(hostRoot),
+	}
+
+	containerCwd = mount.ContainerPath
+	if relativeCwd, err := filepath.Rel(hostRoot, hostCwd); err == nil && relativeCwd != "." {
+		containerCwd += "/" + filepath.ToSlash(relativeCwd)
+	}
+	return mount, containerCwd
+}
+
+// GetProjectRoot returns the directory containing the project's dockerized.env, or the root of the git repository
+// hostCwd is in. Returns "" if hostCwd is not within a project.
+//
+// The home directory is never considered a project root, as it contains the global dockerized.env.
+func GetProjectRoot(hostCwd string, homeDir string) string {
+	if projectEnvFile, err := findProjectEnvFile(hostCwd); err == nil {
+		projectRoot := filepath.Dir(projectEnvFile)
+		if !samePath(projectRoot, homeDir) {
+			return projectRoot
+		}
+	}
+
+	if gitRoot, err := findGitRoot(hostCwd); err == nil {
+		if !samePath(gitRoot, homeDir) {
+			return gitRoot
+		}
+	}
+
+	return ""
+}
+
+func findGitRoot(path string) (string, error) {
+	for {
+		// .git is a directory in regular repositories, and a file in worktrees and submodules.
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", os.ErrNotExist
+		}
+		path = parent
+	}
+}
+
+func containerMountPath(hostPath string) string {
+	dirName := filepath.Base(hostPath)
+	if dirName == "\\" || dirName == "/" {
+		return containerHostRoot
+	}
+	return containerHostRoot + "/" + dirName
+}
+
+func samePath(path1 string, path2 string) bool {
+	return path1 != "" && path2 != "" && filepath.Clean(path1) == filepath.Clean(path2)
+}
@@ -0,0 +1,141 @@
+package dockerized
+
+import (
+	"context"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/hashicorp/go-version"
+	"regexp"
+	"sort"
+)
+
+// closestVersionCount is the number of versions suggested when a version doesn't exist.
+const closestVersionCount = 5
+
+var versionSegmentPattern = regexp.MustCompile(`\d+`)
+var imageNotFoundPattern = regexp.MustCompile(`(?i)manifest unknown|manifest for \S+ not found|repository does not exist|not found: does not exist`)
+
+// IsImageNotFound returns whether err is caused by an image, or a tag of an image, that doesn't exist.
+func IsImageNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errdefs.IsNotFound(err) || imageNotFoundPattern.MatchString(err.Error())
+}
+
+// explainImageNotFound returns a VersionNotFoundError with the closest available versions, if err is caused by a
+// version of the command that doesn't exist. Otherwise, err is returned as is.
+func explainImageNotFound(ctx context.Context, resolver *VersionResolver, composeFilePaths []string, project *types.Project, env *Environment, commandName string, err error) error {
+	if !IsImageNotFound(err) {
+		return err
+	}
+	rawProject, rawErr := getRawProject(composeFilePaths)
+	if rawErr != nil {
+		return err
+	}
+	rawService, rawErr := rawProject.GetService(commandName)
+	if rawErr != nil {
+		return err
+	}
+	variable, rawErr := getVersionVariable(rawService)
+	if rawErr != nil {
+		return err
+	}
+	requested, ok := env.Lookup(variable)
+	if !ok || requested == "" {
+		return err
+	}
+
+	service, serviceErr := project.GetService(commandName)
+	if serviceErr != nil {
+		return err
+	}
+	rawVersions, listErr := listServiceVersions(ctx, resolver.Providers, resolver.Cache, service, env)
+	if listErr != nil {
+		return err
+	}
+	semanticVersions, _ := getSemanticVersions(rawVersions)
+	for _, available := range append(rawVersions, semanticVersions...) {
+		if available == requested {
+			// The version exists, so something else is missing, e.g. a platform of the image.
+			return err
+		}
+	}
+
+	return &VersionNotFoundError{
+		Command:  commandName,
+		Version:  requested,
+		Variable: variable,
+		Closest:  ClosestVersions(requested, semanticVersions, closestVersionCount),
+		Err:      err,
+	}
+}
+
+// ClosestVersions returns up to n of the available versions that are closest to requested, from low to high.
+// Versions that share more leading segments with requested are closer, e.g. 3.10.4 is closer to 3.100 than 3.9.12.
+// If requested is not a version, the highest versions are returned.
+func ClosestVersions(requested string, available []string, n int) []string {
+	versions := append([]string(nil), available...)
+	sortVersions(versions)
+	versions = unique(versions)
+
+	target, err := version.NewVersion(requested)
+	if err == nil {
+		targetSegments := requestedSegments(target, requested)
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versionDistanceLess(targetSegments, versions[i], versions[j])
+		})
+		if len(versions) > n {
+			versions = versions[:n]
+		}
+		sortVersions(versions)
+		return versions
+	}
+
+	if len(versions) > n {
+		versions = versions[len(versions)-n:]
+	}
+	return versions
+}
+
+// requestedSegments returns the segments of v that were specified in raw, e.g. 2 for `3.100`.
+func requestedSegments(v *version.Version, raw string) []int {
+	segments := v.Segments()
+	count := len(versionSegmentPattern.FindAllString(raw, -1))
+	if count > 0 && count < len(segments) {
+		segments = segments[:count]
+	}
+	return segments
+}
+
+// versionDistanceLess compares the distance of a and b to the target segments: first the number of leading segments
+// that are equal, then the difference in the first segment that isn't. Higher versions win ties.
+func versionDistanceLess(target []int, a string, b string) bool {
+	va, errA := version.NewVersion(a)
+	vb, errB := version.NewVersion(b)
+	if errA != nil || errB != nil {
+		return errB != nil && errA == nil
+	}
+	prefixA, differenceA := versionDistance(target, va.Segments())
+	prefixB, differenceB := versionDistance(target, vb.Segments())
+	if prefixA != prefixB {
+		return prefixA > prefixB
+	}
+	if differenceA != differenceB {
+		return differenceA < differenceB
+	}
+	return vb.LessThan(va)
+}
+
+func versionDistance(target []int, segments []int) (prefix int, difference int) {
+	for prefix < len(target) && prefix < len(segments) && target[prefix] == segments[prefix] {
+		prefix++
+	}
+	if prefix < len(target) && prefix < len(segments) {
+		difference = target[prefix] - segments[prefix]
+		if difference < 0 {
+			difference = -difference
+		}
+	}
+	return prefix, difference
+}
@@ -0,0 +1,68 @@
+package dockerized_test
+
+import (
+	"errors"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/datastack-net/dockerized/pkg/fake"
+	"github.com/docker/docker/errdefs"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClosestVersions(t *testing.T) {
+	available := []string{"3.8.12", "3.9.10", "3.9.12", "3.10.0", "3.10.4", "3.11.0", "2.7.18"}
+	assert.Equal(t, []string{"3.9.12", "3.10.0", "3.10.4", "3.11.0"}, dockerized.ClosestVersions("3.100", available, 4))
+	assert.Equal(t, []string{"3.10.0", "3.10.4"}, dockerized.ClosestVersions("3.10.9", available, 2))
+	assert.Equal(t, []string{"3.10.4", "3.11.0"}, dockerized.ClosestVersions("nightly", available, 2))
+}
+
+func TestIsImageNotFound(t *testing.T) {
+	assert.True(t, dockerized.IsImageNotFound(errors.New("Error response from daemon: manifest for python:3.100 not found: manifest unknown: manifest unknown")))
+	assert.True(t, dockerized.IsImageNotFound(errdefs.NotFound(errors.New("no such image"))))
+	assert.False(t, dockerized.IsImageNotFound(errors.New("connection refused")))
+	assert.False(t, dockerized.IsImageNotFound(nil))
+}
+
+// newNotFoundConfig writes a Compose File with an app, of which the versions are listed, and returns the Config to run
+// it on backend with runFake.
+func newNotFoundConfig(t *testing.T, backend *fake.Backend, env ...string) dockerized.Config {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := "services:\n  app:\n    image: \"app:${APP_VERSION:-1.0.0}\"\n    x-dockerized:\n      versions:\n        source: custom\n        name: app\n"
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+	return dockerized.Config{
+		Env:              append([]string{"COMPOSE_FILE=" + composeFile}, env...),
+		Backend:          backend,
+		VersionProviders: dockerized.VersionProviders{"custom": &countingVersionProvider{versions: appVersions}},
+	}
+}
+
+func TestRunSuggestsClosestVersions(t *testing.T) {
+	backend := &fake.Backend{Err: errors.New("manifest for app:1.2.9 not found: manifest unknown: manifest unknown")}
+	_, _, err, exitCode := runFake(t, t.TempDir(), newNotFoundConfig(t, backend), "app:1.2.9")
+	assert.EqualError(t, err, "version 1.2.9 not found for app; closest available: 1.0.0, 1.0.1, 1.2.0, 1.2.3, 2.0.0")
+	assert.Equal(t, dockerized.ExitCodeVersionNotFound, exitCode)
+
+	var notFound *dockerized.VersionNotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "APP_VERSION", notFound.Variable)
+
+	// Versions set in the environment, or .env files, are explained as well.
+	_, _, err, exitCode = runFake(t, t.TempDir(), newNotFoundConfig(t, backend, "APP_VERSION=3.0"), "app")
+	assert.Contains(t, err.Error(), "version 3.0 not found for app")
+	assert.Equal(t, dockerized.ExitCodeVersionNotFound, exitCode)
+}
+
+func TestRunKeepsOtherErrors(t *testing.T) {
+	backend := &fake.Backend{Err: errors.New("connection refused")}
+	_, _, err, exitCode := runFake(t, t.TempDir(), newNotFoundConfig(t, backend), "app:1.2.9")
+	assert.EqualError(t, err, "connection refused")
+	assert.Equal(t, 1, exitCode)
+
+	// The version exists, so the image is missing for another reason.
+	backend = &fake.Backend{Err: errdefs.NotFound(errors.New("no matching manifest for linux/arm64"))}
+	_, _, err, exitCode = runFake(t, t.TempDir(), newNotFoundConfig(t, backend), "app:1.2.3")
+	assert.EqualError(t, err, "no matching manifest for linux/arm64")
+	assert.Equal(t, 1, exitCode)
+}
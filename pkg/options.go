@@ -1,14 +1,24 @@
 package dockerized
 
 const (
-	OptionBuild        = "--build"
-	OptionBuildPull    = "--pull"
-	OptionBuildNoCache = "--no-cache"
-	OptionHelp         = "--help"
-	OptionShell        = "--shell"
-	OptionEntrypoint   = "--entrypoint"
-	OptionVerbose      = "--verbose"
-	OptionVersion      = "--version"
+	OptionBuild          = "--build"
+	OptionBuildPull      = "--pull"
+	OptionBuildNoCache   = "--no-cache"
+	OptionDryRun         = "--dry-run"
+	OptionHelp           = "--help"
+	OptionLatest         = "--latest"
+	OptionLimit          = "--limit"
+	OptionOffline        = "--offline"
+	OptionOutput         = "--output"
+	OptionRefresh        = "--refresh"
+	OptionShell          = "--shell"
+	OptionEntrypoint     = "--entrypoint"
+	OptionMapUser        = "--map-user"
+	OptionTranslatePaths = "--translate-paths"
+	OptionVerbose        = "--verbose"
+	OptionVersion        = "--version"
+	// OptionEndOfOptions runs the service named after it, even if dockerized has a command with the same name.
+	OptionEndOfOptions = "--"
 )
 
 const (
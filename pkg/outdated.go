@@ -0,0 +1,286 @@
+package dockerized
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/datastack-net/dockerized/pkg/util"
+	"github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// outdatedConcurrency is the number of commands whose versions are listed at the same time.
+const outdatedConcurrency = 8
+
+// OutdatedVersion compares the configured version of a command with the latest available versions.
+type OutdatedVersion struct {
+	Command  string `json:"command" yaml:"command"`
+	Variable string `json:"variable" yaml:"variable"`
+	Current  string `json:"current" yaml:"current"`
+	// Source is the .env file that sets the version, LayerEnvironment or LayerDockerized.
+	Source string `json:"source" yaml:"source"`
+	Line   int    `json:"line,omitempty" yaml:"line,omitempty"`
+	// LatestPatch is the latest version with the same minor version, e.g. 1.17.13 for 1.17.8.
+	LatestPatch string `json:"latest_patch,omitempty" yaml:"latest_patch,omitempty"`
+	// LatestMinor is the latest version with the same major version, e.g. 1.18.2 for 1.17.8.
+	LatestMinor string `json:"latest_minor,omitempty" yaml:"latest_minor,omitempty"`
+	// LatestMajor is the latest version, e.g. 2.0.1 for 1.17.8.
+	LatestMajor string `json:"latest_major,omitempty" yaml:"latest_major,omitempty"`
+	Outdated    bool   `json:"outdated" yaml:"outdated"`
+	// Error is set when the versions of the command can't be listed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// CheckOutdatedVersions compares the configured version of each command with the versions available in its version
+// source. Only commands with a <COMMAND>_VERSION variable that is set to a version are checked. If commandNames is
+// empty, all commands are checked.
+func CheckOutdatedVersions(ctx context.Context, resolver *VersionResolver, rawProject *types.Project, project *types.Project, env *Environment, explanations []VariableExplanation, commandNames []string) []OutdatedVersion {
+	explanationsByName := map[string]VariableExplanation{}
+	for _, explanation := range explanations {
+		explanationsByName[explanation.Name] = explanation
+	}
+
+	var results []OutdatedVersion
+	for _, rawService := range rawProject.Services {
+		if len(commandNames) > 0 && !util.Contains(commandNames, rawService.Name) {
+			continue
+		}
+		variable, err := getVersionVariable(rawService)
+		if err != nil || !usesVariable(rawService, variable) {
+			continue
+		}
+		explanation, ok := explanationsByName[variable]
+		if !ok || !explanation.IsSet {
+			continue
+		}
+		if _, err := version.NewVersion(explanation.Value); err != nil {
+			// e.g. latest
+			continue
+		}
+		results = append(results, OutdatedVersion{
+			Command:  rawService.Name,
+			Variable: variable,
+			Current:  explanation.Value,
+			Source:   explanation.Source.Layer,
+			Line:     explanation.Source.Line,
+		})
+	}
+
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, outdatedConcurrency)
+	for i := range results {
+		wait.Add(1)
+		go func(result *OutdatedVersion) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			checkOutdatedVersion(ctx, resolver, project, env, result)
+		}(&results[i])
+	}
+	wait.Wait()
+	return results
+}
+
+func checkOutdatedVersion(ctx context.Context, resolver *VersionResolver, project *types.Project, env *Environment, result *OutdatedVersion) {
+	service, err := project.GetService(result.Command)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	rawVersions, err := listServiceVersions(ctx, resolver.Providers, resolver.Cache, service, env)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	semanticVersions, _ := getSemanticVersions(rawVersions)
+	sortVersions(semanticVersions)
+
+	current, err := version.NewVersion(result.Current)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	result.LatestPatch, result.LatestMinor, result.LatestMajor = latestVersions(current, semanticVersions)
+	// Partial versions, e.g. 3.10, are only outdated by a newer minor version.
+	specified := len(versionSegmentPattern.FindAllString(result.Current, -1))
+	if latest, err := version.NewVersion(result.LatestMajor); err == nil {
+		result.Outdated = compareSegments(latest.Segments(), current.Segments(), specified) > 0
+	}
+}
+
+// latestVersions returns the latest of the sorted semanticVersions with the same minor version as current, with the
+// same major version, and overall.
+func latestVersions(current *version.Version, semanticVersions []string) (patch string, minor string, major string) {
+	currentSegments := current.Segments()
+	for _, semanticVersion := range semanticVersions {
+		v, err := version.NewVersion(semanticVersion)
+		if err != nil {
+			continue
+		}
+		segments := v.Segments()
+		if segments[0] == currentSegments[0] && segments[1] == currentSegments[1] {
+			patch = semanticVersion
+		}
+		if segments[0] == currentSegments[0] {
+			minor = semanticVersion
+		}
+		major = semanticVersion
+	}
+	return patch, minor, major
+}
+
+func usesVariable(service types.ServiceConfig, variable string) bool {
+	for _, used := range ExtractVariables(service) {
+		if variableName(used) == variable {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSegments compares the first n segments of a and b.
+func compareSegments(a []int, b []int, n int) int {
+	for i := 0; i < n && i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func runOutdatedCommand(ctx context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	all := flags.Bool("all", false, "Also list versions that are up to date, or can't be checked.")
+	output := flags.String("output", OutputPlain, "Print the versions as plain, json or yaml.")
+	exitCode := flags.Bool("exit-code", false, "Exit with code 1 if any version is outdated.")
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+	if !IsOutputFormat(*output) {
+		return &UsageError{Message: fmt.Sprintf("unsupported output format: %s\nUsage: dockerized %s", *output, meta.Command.Usage)}
+	}
+
+	rawProject, err := getRawProject(meta.ComposeFilePaths)
+	if err != nil {
+		return err
+	}
+	project, err := meta.GetProject()
+	if err != nil {
+		return err
+	}
+	for _, name := range flags.Args() {
+		if _, err := rawProject.GetService(name); err != nil {
+			return err
+		}
+	}
+	explanations := ExplainEnvironment(meta.Environ, meta.EnvFiles, meta.Env, rawProject)
+	results := CheckOutdatedVersions(ctx, meta.Resolver, rawProject, project, meta.Env, explanations, flags.Args())
+
+	outdatedCount := 0
+	var listed []OutdatedVersion
+	for _, result := range results {
+		if result.Outdated {
+			outdatedCount++
+		}
+		if *all || result.Outdated {
+			listed = append(listed, result)
+		}
+	}
+	sortOutdatedVersions(listed, meta.EnvFiles)
+
+	if err = printOutdatedVersions(meta.Stdout, listed, *output); err != nil {
+		return err
+	}
+	if *output == OutputPlain && !*all {
+		for _, result := range results {
+			if result.Error != "" {
+				fmt.Fprintf(meta.Stdout, "Cannot check %s: %s\n", result.Command, result.Error)
+			}
+		}
+	}
+	if *exitCode && outdatedCount > 0 {
+		return &OutdatedError{Count: outdatedCount}
+	}
+	return nil
+}
+
+// sortOutdatedVersions sorts by source, in order of precedence from low to high, and then by command.
+func sortOutdatedVersions(results []OutdatedVersion, envFiles []EnvFile) {
+	sourceOrder := map[string]int{}
+	for i, envFile := range envFiles {
+		sourceOrder[envFile.Path] = i
+	}
+	sourceOrder[LayerEnvironment] = len(envFiles)
+	sourceOrder[LayerDockerized] = len(envFiles) + 1
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Source != results[j].Source {
+			return sourceOrder[results[i].Source] < sourceOrder[results[j].Source]
+		}
+		return results[i].Command < results[j].Command
+	})
+}
+
+func printOutdatedVersions(out io.Writer, results []OutdatedVersion, format string) error {
+	switch format {
+	case OutputJson:
+		if results == nil {
+			results = []OutdatedVersion{}
+		}
+		content, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", content)
+		return err
+	case OutputYaml:
+		content, err := yaml.Marshal(results)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(content)
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintf(out, "All versions are up to date.\n")
+		return nil
+	}
+	source := ""
+	var writer *tabwriter.Writer
+	for _, result := range results {
+		if writer == nil || result.Source != source {
+			if writer != nil {
+				writer.Flush()
+				fmt.Fprintln(out)
+			}
+			source = result.Source
+			fmt.Fprintf(out, "%s\n", source)
+			writer = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(writer, "  COMMAND\tVARIABLE\tCURRENT\tPATCH\tMINOR\tMAJOR\n")
+		}
+		if result.Error != "" {
+			fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\t\t\n", result.Command, result.Variable, result.Current, "error: "+strings.SplitN(result.Error, "\n", 2)[0])
+			continue
+		}
+		fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\t%s\t%s\n", result.Command, result.Variable, result.Current,
+			orDash(result.LatestPatch), orDash(result.LatestMinor), orDash(result.LatestMajor))
+	}
+	return writer.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package dockerized_test
+
+import (
+	"encoding/json"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newOutdatedProject writes a project with a dockerized.env, of which some versions are outdated. It returns the project
+// directory and the Config to run it with runFake.
+func newOutdatedProject(t *testing.T) (string, dockerized.Config) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	compose := `services:
+  app:
+    image: "app:${APP_VERSION}"
+    x-dockerized:
+      versions: {source: custom, name: app}
+  tool:
+    image: "tool:${TOOL_VERSION}"
+    x-dockerized:
+      versions: {source: custom, name: tool}
+  web:
+    image: "web:${WEB_VERSION}"
+    x-dockerized:
+      versions: {source: custom, name: web}
+  broken:
+    image: "broken:${BROKEN_VERSION}"
+    x-dockerized:
+      versions: {source: unknown, name: broken}
+  nightly:
+    image: "nightly:${NIGHTLY_VERSION}"
+`
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+	envFile := filepath.Join(dir, "dockerized.env")
+	assert.Nil(t, os.WriteFile(envFile, []byte("APP_VERSION=1.0.0\nWEB_VERSION=1.2\nBROKEN_VERSION=1.0.0\nNIGHTLY_VERSION=latest\n"), 0644))
+
+	return dir, dockerized.Config{
+		Env:              []string{"COMPOSE_FILE=" + composeFile, "TOOL_VERSION=2.0.0"},
+		VersionProviders: dockerized.VersionProviders{"custom": staticVersionProvider(appVersions)},
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	dir, config := newOutdatedProject(t)
+	envFile := filepath.Join(dir, "dockerized.env")
+	_, output, err, exitCode := runFake(t, dir, config, "outdated")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, envFile+"\n"+
+		"  COMMAND  VARIABLE     CURRENT  PATCH  MINOR  MAJOR\n"+
+		"  app      APP_VERSION  1.0.0    1.0.1  1.2.3  2.0.0\n"+
+		"  web      WEB_VERSION  1.2      1.2.3  1.2.3  2.0.0\n"+
+		"Cannot check broken: cannot list versions for command broken: unknown version source unknown\n", output)
+}
+
+func TestOutdatedJson(t *testing.T) {
+	dir, config := newOutdatedProject(t)
+	envFile := filepath.Join(dir, "dockerized.env")
+	_, output, err, _ := runFake(t, dir, config, "outdated", "--all", "--output", "json", "app", "tool")
+	assert.Nil(t, err)
+
+	var results []dockerized.OutdatedVersion
+	assert.Nil(t, json.Unmarshal([]byte(output), &results))
+	assert.Equal(t, []dockerized.OutdatedVersion{
+		{Command: "app", Variable: "APP_VERSION", Current: "1.0.0", Source: envFile, Line: 1, LatestPatch: "1.0.1", LatestMinor: "1.2.3", LatestMajor: "2.0.0", Outdated: true},
+		{Command: "tool", Variable: "TOOL_VERSION", Current: "2.0.0", Source: dockerized.LayerEnvironment, LatestPatch: "2.0.0", LatestMinor: "2.0.0", LatestMajor: "2.0.0"},
+	}, results)
+}
+
+func TestOutdatedExitCode(t *testing.T) {
+	dir, config := newOutdatedProject(t)
+	_, _, err, exitCode := runFake(t, dir, config, "outdated", "--exit-code")
+	assert.EqualError(t, err, "2 versions are outdated")
+	assert.Equal(t, 1, exitCode)
+
+	_, _, err, exitCode = runFake(t, dir, config, "outdated", "--exit-code", "tool")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+}
@@ -0,0 +1,195 @@
+package dockerized
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PathTranslator translates absolute paths between the host and the command container, for paths within the
+// mounted host directory.
+type PathTranslator struct {
+	mount HostMount
+}
+
+func NewPathTranslator(mount HostMount) PathTranslator {
+	return PathTranslator{mount: mount}
+}
+
+// ToContainer replaces absolute host paths in value with container paths.
+// e.g. `-I/home/me/repo/proto` becomes `-I/host/repo/proto`
+func (t PathTranslator) ToContainer(value string) string {
+	return replacePathPrefix(value, t.mount.HostPath, t.mount.ContainerPath, filepath.Separator, '/')
+}
+
+// ToHost replaces container paths in value with absolute host paths.
+// e.g. `/host/repo/main.go:12: undefined: foo` becomes `/home/me/repo/main.go:12: undefined: foo`
+func (t PathTranslator) ToHost(value string) string {
+	return replacePathPrefix(value, t.mount.ContainerPath, t.mount.HostPath, '/', filepath.Separator)
+}
+
+// ToContainerArgs translates each argument with ToContainer.
+func (t PathTranslator) ToContainerArgs(args []string) []string {
+	var translatedArgs []string
+	for _, arg := range args {
+		translatedArgs = append(translatedArgs, t.ToContainer(arg))
+	}
+	return translatedArgs
+}
+
+// pathFlushDelay is how long PathTranslatingWriter holds back the possible start of a path, waiting for the rest of it.
+// A prompt that ends in a partial path is shown after this delay.
+const pathFlushDelay = 50 * time.Millisecond
+
+// Writer returns a writer which translates container paths written to it into host paths, before writing them to out.
+func (t PathTranslator) Writer(out io.Writer) *PathTranslatingWriter {
+	return t.writerWithDelay(out, pathFlushDelay)
+}
+
+// writerWithDelay is Writer, with the delay after which data that was held back is written anyway.
+func (t PathTranslator) writerWithDelay(out io.Writer, flushDelay time.Duration) *PathTranslatingWriter {
+	return &PathTranslatingWriter{
+		out:        out,
+		translator: t,
+		flushDelay: flushDelay,
+	}
+}
+
+// PathTranslatingWriter translates container paths into host paths. See PathTranslator.Writer.
+type PathTranslatingWriter struct {
+	out        io.Writer
+	translator PathTranslator
+	flushDelay time.Duration
+
+	mutex   sync.Mutex
+	pending []byte
+	timer   *time.Timer
+}
+
+func (w *PathTranslatingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	data := append(w.pending, p...)
+	// Hold back the end of the data if it may be the start of a path, which will be completed by the next write.
+	keep := partialSuffixLength(data, w.translator.mount.ContainerPath)
+	w.pending = append([]byte{}, data[len(data)-keep:]...)
+	_, err := io.WriteString(w.out, w.translator.ToHost(string(data[:len(data)-keep])))
+	if len(w.pending) > 0 {
+		// Don't hold back a prompt, or a partial line, if nothing follows.
+		w.timer = time.AfterFunc(w.flushDelay, func() {
+			_ = w.Flush()
+		})
+	}
+	return len(p), err
+}
+
+// Flush writes any data held back by Write.
+func (w *PathTranslatingWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.out, w.translator.ToHost(string(w.pending)))
+	w.pending = nil
+	return err
+}
+
+// Returns the length of the longest suffix of data that is a prefix of pattern.
+func partialSuffixLength(data []byte, pattern string) int {
+	for length := len(pattern); length > 0; length-- {
+		if len(data) >= length && string(data[len(data)-length:]) == pattern[:length] {
+			return length
+		}
+	}
+	return 0
+}
+
+// Replaces path prefix `from` by `to` in value, and converts path separators in the rest of each replaced path.
+// Only whole paths are replaced: `/home/me/repo` is not replaced in `/home/me/repo2` or `/x/home/me/repo`.
+func replacePathPrefix(value string, from string, to string, fromSeparator rune, toSeparator rune) string {
+	if from == "" {
+		return value
+	}
+	var result strings.Builder
+	for {
+		index := indexOfPath(value, from, fromSeparator)
+		if index < 0 {
+			result.WriteString(value)
+			return result.String()
+		}
+		result.WriteString(value[:index])
+		rest := value[index+len(from):]
+
+		tailLength := strings.IndexFunc(rest, isPathDelimiter)
+		if tailLength < 0 {
+			tailLength = len(rest)
+		}
+		tail := rest[:tailLength]
+		if strings.HasSuffix(from, string(fromSeparator)) {
+			// from is a root directory, e.g. `/` or `C:\`
+			tail = string(fromSeparator) + tail
+		}
+		if fromSeparator != toSeparator {
+			tail = strings.ReplaceAll(tail, string(fromSeparator), string(toSeparator))
+		}
+
+		translated := strings.TrimSuffix(to, string(toSeparator)) + tail
+		if translated == "" {
+			translated = string(toSeparator)
+		}
+		result.WriteString(translated)
+		value = rest[tailLength:]
+	}
+}
+
+func indexOfPath(value string, path string, separator rune) int {
+	offset := 0
+	for {
+		index := strings.Index(value[offset:], path)
+		if index < 0 {
+			return -1
+		}
+		start := offset + index
+		end := start + len(path)
+		isRoot := strings.HasSuffix(path, string(separator))
+		if isPathStart(value, start) && (isRoot || isPathEnd(value, end, separator)) {
+			return start
+		}
+		offset = start + 1
+	}
+}
+
+func isPathStart(value string, index int) bool {
+	if index == 0 {
+		return true
+	}
+	// Short option with attached value, e.g. -I/path
+	if index == 2 && value[0] == '-' {
+		return true
+	}
+	return isPathDelimiter(rune(value[index-1]))
+}
+
+func isPathEnd(value string, index int, separator rune) bool {
+	if index == len(value) {
+		return true
+	}
+	next := rune(value[index])
+	return next == separator || isPathDelimiter(next)
+}
+
+func isPathDelimiter(r rune) bool {
+	return strings.ContainsRune(" \t\r\n\"'`=,;:()[]<>|", r)
+}
@@ -0,0 +1,117 @@
+package dockerized_test
+
+import (
+	"bytes"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplacePathPrefix(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		value         string
+		from          string
+		to            string
+		fromSeparator rune
+		toSeparator   rune
+		expected      string
+	}{
+		{"path", "/host/repo/main.go:12: error", "/host/repo", "/home/me/repo", '/', '/', "/home/me/repo/main.go:12: error"},
+		{"exact path", "/host/repo", "/host/repo", "/home/me/repo", '/', '/', "/home/me/repo"},
+		{"multiple paths", "cp /host/repo/a /host/repo/b", "/host/repo", "/r", '/', '/', "cp /r/a /r/b"},
+		{"short option", "-I/home/me/repo/proto", "/home/me/repo", "/host/repo", '/', '/', "-I/host/repo/proto"},
+		{"quoted", `"/host/repo/a b"`, "/host/repo", "/r", '/', '/', `"/r/a b"`},
+		{"mid-word", "x/host/repo/main.go", "/host/repo", "/r", '/', '/', "x/host/repo/main.go"},
+		{"longer name", "/host/repo2/main.go", "/host/repo", "/r", '/', '/', "/host/repo2/main.go"},
+		{"nested in other path", "/x/host/repo", "/host/repo", "/r", '/', '/', "/x/host/repo"},
+		{"root to container", "/etc/hosts", "/", "/host", '/', '/', "/host/etc/hosts"},
+		{"container to root", "/host/etc/hosts", "/host", "/", '/', '/', "/etc/hosts"},
+		{"container root to root", "/host", "/host", "/", '/', '/', "/"},
+		{"windows to container", `C:\Users\me\repo\src\main.go`, `C:\Users\me\repo`, "/host/repo", '\\', '/', "/host/repo/src/main.go"},
+		{"container to windows", "/host/repo/src/main.go:3", "/host/repo", `C:\Users\me\repo`, '/', '\\', `C:\Users\me\repo\src\main.go:3`},
+		{"windows root", `C:\temp\x`, `C:\`, "/host", '\\', '/', "/host/temp/x"},
+		{"empty prefix", "/host/repo", "", "/r", '/', '/', "/host/repo"},
+	}
+	for _, test := range tests {
+		actual := dockerized.ReplacePathPrefix(test.value, test.from, test.to, test.fromSeparator, test.toSeparator)
+		assert.Equal(t, test.expected, actual, test.name)
+	}
+}
+
+func TestPathTranslatorArgs(t *testing.T) {
+	t.Parallel()
+	translator := dockerized.NewPathTranslator(dockerized.HostMount{HostPath: "/home/me/repo", ContainerPath: "/host/repo"})
+	assert.Equal(t,
+		[]string{"-I/host/repo/proto", "/host/repo/a.proto", "relative/a.proto", "/home/me/repo2"},
+		translator.ToContainerArgs([]string{"-I/home/me/repo/proto", "/home/me/repo/a.proto", "relative/a.proto", "/home/me/repo2"}),
+	)
+}
+
+// syncBuffer is a bytes.Buffer that can be written by the flush timer while the test reads it.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func TestPathTranslatingWriter(t *testing.T) {
+	t.Parallel()
+	translator := dockerized.NewPathTranslator(dockerized.HostMount{HostPath: "/home/me/repo", ContainerPath: "/host/repo"})
+	tests := []struct {
+		name     string
+		writes   []string
+		held     string
+		expected string
+	}{
+		{"single write", []string{"/host/repo/main.go:1\n"}, "/home/me/repo/main.go:1\n", "/home/me/repo/main.go:1\n"},
+		{"prefix split across writes", []string{"error in /ho", "st/repo/main.go\n"}, "error in /home/me/repo/main.go\n", "error in /home/me/repo/main.go\n"},
+		{"split after prefix", []string{"/host/repo", "/main.go\n"}, "/home/me/repo/main.go\n", "/home/me/repo/main.go\n"},
+		{"ends in slash", []string{"$ cd /"}, "$ cd ", "$ cd /"},
+		{"ends in path", []string{"cd /host/re", "po"}, "cd ", "cd /home/me/repo"},
+		{"not a path", []string{"/hosts\n"}, "/hosts\n", "/hosts\n"},
+	}
+	for _, test := range tests {
+		var out syncBuffer
+		writer := dockerized.WriterWithDelay(translator, &out, time.Hour)
+		for _, write := range test.writes {
+			n, err := writer.Write([]byte(write))
+			assert.Nil(t, err, test.name)
+			assert.Equal(t, len(write), n, test.name)
+		}
+		assert.Equal(t, test.held, out.String(), test.name)
+		assert.Nil(t, writer.Flush(), test.name)
+		assert.Equal(t, test.expected, out.String(), test.name)
+		assert.Nil(t, writer.Flush(), test.name)
+		assert.Equal(t, test.expected, out.String(), test.name)
+	}
+}
+
+func TestPathTranslatingWriterFlushesPrompt(t *testing.T) {
+	t.Parallel()
+	translator := dockerized.NewPathTranslator(dockerized.HostMount{HostPath: "/home/me/repo", ContainerPath: "/host/repo"})
+	var out syncBuffer
+	writer := dockerized.WriterWithDelay(translator, &out, 10*time.Millisecond)
+	_, err := writer.Write([]byte("Save to /"))
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return out.String() == "Save to /" }, time.Second, 5*time.Millisecond)
+
+	// The rest of a path that was flushed is written as is.
+	_, err = writer.Write([]byte("tmp\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Save to /tmp\n", out.String())
+}
@@ -0,0 +1,287 @@
+package dockerized
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/cli/cli/config"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RegistryCredentials returns the username and password for a registry host, or empty strings for anonymous access.
+type RegistryCredentials func(host string) (username string, password string)
+
+// RegistryClient lists the tags of images in registries that implement the Registry v2 API, such as
+// mcr.microsoft.com, ghcr.io, quay.io and private registries.
+type RegistryClient struct {
+	httpClient  *http.Client
+	credentials RegistryCredentials
+}
+
+func NewRegistryClient(credentials RegistryCredentials) *RegistryClient {
+	return &RegistryClient{
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		credentials: credentials,
+	}
+}
+
+// DockerCredentials returns the credentials stored by `docker login`, including those in credential helpers.
+func DockerCredentials(env *Environment) RegistryCredentials {
+	return func(host string) (string, string) {
+		configDir := env.Get("DOCKER_CONFIG")
+		if configDir == "" {
+			configDir = filepath.Join(env.HomeDir(), ".docker")
+		}
+		configFile, err := config.Load(configDir)
+		if err != nil {
+			return "", ""
+		}
+		authConfig, err := configFile.GetAuthConfig(host)
+		if err != nil {
+			return "", ""
+		}
+		if authConfig.IdentityToken != "" {
+			return "<token>", authConfig.IdentityToken
+		}
+		return authConfig.Username, authConfig.Password
+	}
+}
+
+type registryTagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// ListTags returns all tags of the repository in the registry at host, following pagination.
+func (c *RegistryClient) ListTags(ctx context.Context, host string, repository string) ([]string, error) {
+	nextUrl := &url.URL{
+		Scheme:   registryScheme(host),
+		Host:     host,
+		Path:     "/v2/" + repository + "/tags/list",
+		RawQuery: "n=1000",
+	}
+
+	var tags []string
+	var token string
+	for nextUrl != nil {
+		response, err := c.get(ctx, nextUrl, token)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusUnauthorized && token == "" {
+			challenge := response.Header.Get("WWW-Authenticate")
+			_ = response.Body.Close()
+			token, err = c.authenticate(ctx, host, repository, challenge)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		tagList, err := decodeRegistryTagList(response)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list tags of %s/%s: %w", host, repository, err)
+		}
+		tags = append(tags, tagList.Tags...)
+
+		nextUrl, err = nextPageUrl(nextUrl, response.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// manifestMediaTypes are the manifests accepted by GetDigest. Multi-platform images are identified by their index.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// GetDigest returns the digest of the manifest of the tag of the repository in the registry at host, e.g. `sha256:...`.
+func (c *RegistryClient) GetDigest(ctx context.Context, host string, repository string, tag string) (string, error) {
+	manifestUrl := &url.URL{
+		Scheme: registryScheme(host),
+		Host:   host,
+		Path:   "/v2/" + repository + "/manifests/" + tag,
+	}
+	accept := strings.Join(manifestMediaTypes, ", ")
+
+	var token string
+	for {
+		response, err := c.do(ctx, http.MethodHead, manifestUrl, token, accept)
+		if err != nil {
+			return "", err
+		}
+		_ = response.Body.Close()
+		if response.StatusCode == http.StatusUnauthorized && token == "" {
+			token, err = c.authenticate(ctx, host, repository, response.Header.Get("WWW-Authenticate"))
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		if response.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("cannot get digest of %s/%s:%s: registry responded with %s", host, repository, tag, response.Status)
+		}
+		digest := response.Header.Get("Docker-Content-Digest")
+		if digest == "" {
+			return "", fmt.Errorf("cannot get digest of %s/%s:%s: registry didn't return it", host, repository, tag)
+		}
+		return digest, nil
+	}
+}
+
+func (c *RegistryClient) get(ctx context.Context, requestUrl *url.URL, token string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, requestUrl, token, "application/json")
+}
+
+func (c *RegistryClient) do(ctx context.Context, method string, requestUrl *url.URL, token string, accept string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, requestUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", accept)
+	if strings.HasPrefix(token, "Basic ") {
+		request.Header.Set("Authorization", token)
+	} else if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.httpClient.Do(request)
+}
+
+func decodeRegistryTagList(response *http.Response) (registryTagList, error) {
+	defer response.Body.Close()
+	var tagList registryTagList
+	if response.StatusCode != http.StatusOK {
+		return tagList, fmt.Errorf("registry responded with %s", response.Status)
+	}
+	err := json.NewDecoder(response.Body).Decode(&tagList)
+	return tagList, err
+}
+
+// authenticate returns the Authorization for the challenge of the registry. Bearer tokens are requested from the
+// token server in the challenge, using the credentials of the user if any.
+// See https://docs.docker.com/registry/spec/auth/token/
+func (c *RegistryClient) authenticate(ctx context.Context, host string, repository string, challenge string) (string, error) {
+	scheme, parameters := parseAuthChallenge(challenge)
+	var username, password string
+	if c.credentials != nil {
+		username, password = c.credentials(host)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", fmt.Errorf("registry %s requires authentication, please use `docker login %s`", host, host)
+		}
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.SetBasicAuth(username, password)
+		return request.Header.Get("Authorization"), nil
+	case "bearer":
+		break
+	default:
+		return "", fmt.Errorf("registry %s requires unsupported authentication: %q", host, challenge)
+	}
+
+	realm, err := url.Parse(parameters["realm"])
+	if err != nil || parameters["realm"] == "" {
+		return "", fmt.Errorf("registry %s returned an invalid authentication challenge: %q", host, challenge)
+	}
+	query := realm.Query()
+	if parameters["service"] != "" {
+		query.Set("service", parameters["service"])
+	}
+	scope := parameters["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot authenticate to registry %s: %s", host, response.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&tokenResponse)
+	if err != nil {
+		return "", fmt.Errorf("cannot authenticate to registry %s: %w", host, err)
+	}
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	if tokenResponse.AccessToken != "" {
+		return tokenResponse.AccessToken, nil
+	}
+	return "", fmt.Errorf("cannot authenticate to registry %s: no token received", host)
+}
+
+var authChallengeParameterPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseAuthChallenge parses a WWW-Authenticate header, e.g.
+// `Bearer realm="https://auth.example.com/token",service="registry.example.com"`
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	scheme := challenge
+	if index := strings.IndexByte(challenge, ' '); index >= 0 {
+		scheme = challenge[:index]
+	}
+	parameters := map[string]string{}
+	for _, match := range authChallengeParameterPattern.FindAllStringSubmatch(challenge, -1) {
+		parameters[strings.ToLower(match[1])] = match[2]
+	}
+	return scheme, parameters
+}
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// nextPageUrl returns the url of the next page from the Link header, or nil for the last page.
+func nextPageUrl(current *url.URL, link string) (*url.URL, error) {
+	match := linkNextPattern.FindStringSubmatch(link)
+	if match == nil {
+		return nil, nil
+	}
+	next, err := url.Parse(match[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Link header %q: %w", link, err)
+	}
+	return current.ResolveReference(next), nil
+}
+
+// Registries on the local machine are accessed over http, as Docker does.
+func registryScheme(host string) string {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return "http"
+	}
+	if ip := net.ParseIP(hostname); ip != nil && ip.IsLoopback() {
+		return "http"
+	}
+	return "https"
+}
@@ -0,0 +1,168 @@
+package dockerized_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRegistry starts a registry with the given tags for repository `library/app`, which requires a bearer token.
+// The token is only issued to user:secret. The digest of each tag is testDigest(tag).
+func newTestRegistry(t *testing.T, tags []string, pageSize int) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:library/app:pull" || r.URL.Query().Get("service") != "test-registry" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "test-token"})
+		case "/v2/library/app/tags/list":
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:library/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			start := 0
+			if last := r.URL.Query().Get("last"); last != "" {
+				for i, tag := range tags {
+					if tag == last {
+						start = i + 1
+					}
+				}
+			}
+			end := start + pageSize
+			if end < len(tags) {
+				w.Header().Set("Link", fmt.Sprintf(`</v2/library/app/tags/list?n=%d&last=%s>; rel="next"`, pageSize, tags[end-1]))
+			} else {
+				end = len(tags)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "library/app", "tags": tags[start:end]})
+		default:
+			tag := strings.TrimPrefix(r.URL.Path, "/v2/library/app/manifests/")
+			if tag == r.URL.Path || r.Method != http.MethodHead || !containsTag(tags, tag) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:library/app:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", testDigest(tag))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testDigest(tag string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(tag)))
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func testCredentials(username string, password string) dockerized.RegistryCredentials {
+	return func(host string) (string, string) {
+		return username, password
+	}
+}
+
+func TestRegistryListTags(t *testing.T) {
+	tags := []string{"1.0.0", "1.1.0", "1.2.0", "2.0.0", "latest"}
+	server := newTestRegistry(t, tags, 2)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := dockerized.NewRegistryClient(testCredentials("user", "secret"))
+	listed, err := client.ListTags(context.Background(), host, "library/app")
+	assert.Nil(t, err)
+	assert.Equal(t, tags, listed)
+}
+
+func TestRegistryGetDigest(t *testing.T) {
+	server := newTestRegistry(t, []string{"1.0.0", "2.0.0"}, 10)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := dockerized.NewRegistryClient(testCredentials("user", "secret"))
+	digest, err := client.GetDigest(context.Background(), host, "library/app", "2.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, testDigest("2.0.0"), digest)
+
+	_, err = client.GetDigest(context.Background(), host, "library/app", "3.0.0")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+func TestRegistryListTagsWithoutCredentials(t *testing.T) {
+	server := newTestRegistry(t, []string{"1.0.0"}, 10)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := dockerized.NewRegistryClient(testCredentials("", ""))
+	_, err := client.ListTags(context.Background(), host, "library/app")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
+
+func TestRegistryListTagsAnonymous(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "app", "tags": []string{"3.1", "3.2"}})
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := dockerized.NewRegistryClient(nil)
+	listed, err := client.ListTags(context.Background(), host, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3.1", "3.2"}, listed)
+}
+
+func TestRunListVersionsFromRegistry(t *testing.T) {
+	server := newTestRegistry(t, []string{"1.0.0", "1.1.0", "2.0.0", "latest"}, 2)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// Credentials of `docker login`
+	home := t.TempDir()
+	dockerConfig := fmt.Sprintf(`{"auths": {"%s": {"auth": "%s"}}}`, host, base64.StdEncoding.EncodeToString([]byte("user:secret")))
+	assert.Nil(t, os.MkdirAll(filepath.Join(home, ".docker"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(home, ".docker", "config.json"), []byte(dockerConfig), 0644))
+
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := fmt.Sprintf("services:\n  app:\n    image: \"%s/library/app:${APP_VERSION}\"\n", host)
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+
+	_, output, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{Env: []string{
+		"HOME=" + home,
+		"COMPOSE_FILE=" + composeFile,
+		"APP_VERSION=1.0.0",
+	}}, "app:?")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "1.0.0\n1.1.0\n2.0.0\n", output)
+}
@@ -0,0 +1,237 @@
+package dockerized
+
+import (
+	"context"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/hashicorp/go-version"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var partialVersionPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.[x*])?$`)
+var caretTildeVersionPattern = regexp.MustCompile(`^([\^~])v?(\d+)(?:\.(\d+))?(?:\.(\d+))?$`)
+
+// IsPartialVersion returns whether v has only a major, or a major and minor version, e.g. `16`, `3.10` or `16.x`.
+func IsPartialVersion(v string) bool {
+	return partialVersionPattern.MatchString(v)
+}
+
+// IsVersionRange returns whether v is a version constraint, e.g. `^16.2`, `~3.10`, `~> 1.2` or `>= 1.2, < 2`.
+func IsVersionRange(v string) bool {
+	return strings.IndexAny(v, "^~<>=!") == 0 || strings.Contains(v, ",")
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// VersionConstraints converts a version range or partial version to constraints:
+//   - `16` and `16.x` match 16.*, `3.10` matches 3.10.*
+//   - `^1.2.3` matches versions that don't change the first non-zero segment, e.g. 1.*, or 0.2.* for `^0.2.3`
+//   - `~1.2.3` and `~1.2` match 1.2.*, `~1` matches 1.*
+//   - Other ranges use the syntax of hashicorp/go-version, e.g. `~> 1.2`, `>= 1.2, < 2`
+func VersionConstraints(v string) (version.Constraints, error) {
+	v = strings.TrimSpace(v)
+	if match := partialVersionPattern.FindStringSubmatch(v); match != nil {
+		return versionConstraintsBelow(match[1:3], len(nonEmpty(match[1:3]))-1)
+	}
+	if match := caretTildeVersionPattern.FindStringSubmatch(v); match != nil {
+		segments := nonEmpty(match[2:5])
+		if match[1] == "~" {
+			return versionConstraintsBelow(segments, min(len(segments)-1, 1))
+		}
+		// ^: the first non-zero segment may not change, or the last specified segment, if all are zero.
+		bump := len(segments) - 1
+		for i, segment := range segments {
+			if segment != "0" {
+				bump = i
+				break
+			}
+		}
+		return versionConstraintsBelow(segments, bump)
+	}
+	constraints, err := version.NewConstraint(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version range %q: %w", v, err)
+	}
+	return constraints, nil
+}
+
+// versionConstraintsBelow returns the constraints `>= segments, < segments with segment bump incremented`.
+func versionConstraintsBelow(segments []string, bump int) (version.Constraints, error) {
+	segments = nonEmpty(segments)
+	upper := make([]string, bump+1)
+	copy(upper, segments[:bump+1])
+	n, err := strconv.Atoi(upper[bump])
+	if err != nil {
+		return nil, err
+	}
+	upper[bump] = strconv.Itoa(n + 1)
+	return version.NewConstraint(fmt.Sprintf(">= %s, < %s", strings.Join(segments, "."), strings.Join(upper, ".")))
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// VersionResolver resolves version ranges and partial versions to the highest matching version of a command.
+type VersionResolver struct {
+	Providers VersionProviders
+	// Cache stores the versions of commands on disk. If nil, versions are listed on every call.
+	Cache *VersionCache
+}
+
+// Resolve returns the highest version of the command that matches the range or partial version in spec. The
+// variable is the version variable of the command, which is ignored while finding the versions.
+func (r *VersionResolver) Resolve(ctx context.Context, composeFilePaths []string, env *Environment, commandName string, variable string, spec string) (string, error) {
+	constraints, err := VersionConstraints(spec)
+	if err != nil {
+		return "", err
+	}
+
+	// The version of the image doesn't matter, but it must be valid to determine the version source.
+	resolveEnv := NewEnvironment(env.Environ())
+	resolveEnv.Set(variable, "latest")
+	project, err := GetProject(composeFilePaths, resolveEnv)
+	if err != nil {
+		return "", err
+	}
+	service, err := project.GetService(commandName)
+	if err != nil {
+		return "", err
+	}
+	rawVersions, err := listServiceVersions(ctx, r.Providers, r.Cache, service, env)
+	if err != nil {
+		return "", err
+	}
+
+	semanticVersions, err := getSemanticVersions(rawVersions)
+	if err != nil {
+		return "", err
+	}
+	sortVersions(semanticVersions)
+	for i := len(semanticVersions) - 1; i >= 0; i-- {
+		v, err := version.NewVersion(semanticVersions[i])
+		if err == nil && constraints.Check(v) {
+			return semanticVersions[i], nil
+		}
+	}
+	return "", &NoMatchingVersionError{Command: commandName, Range: spec}
+}
+
+// ResolveEnvFileVersions resolves the version variables of the command that are set to a range in a dockerized.env
+// file, e.g. `NODE_VERSION=^16.2`.
+//
+// Partial versions, e.g. `PYTHON_VERSION=3.10`, are valid tags, so they are only resolved if DOCKERIZED_RESOLVE_VERSIONS
+// is set. Otherwise, the same configuration would run a different version from day to day. Partial versions are kept as
+// they are, with a warning, if they can't be resolved.
+func ResolveEnvFileVersions(ctx context.Context, out io.Writer, warnings io.Writer, resolver *VersionResolver, composeFilePaths []string, envFiles []EnvFile, env *Environment, commandName string, verbose bool) error {
+	resolvePartial, _ := strconv.ParseBool(env.Get("DOCKERIZED_RESOLVE_VERSIONS"))
+	if !hasUnresolvedEnvFileVersions(envFiles, resolvePartial) {
+		// Avoid loading the project on every run.
+		return nil
+	}
+	rawProject, err := getRawProject(composeFilePaths)
+	if err != nil {
+		return err
+	}
+	rawService, err := rawProject.GetService(commandName)
+	if err != nil {
+		// Not a service, e.g. a fallback image.
+		return nil
+	}
+
+	for _, variable := range ExtractVariables(rawService) {
+		variable = variableName(variable)
+		if !strings.HasSuffix(variable, "_VERSION") {
+			continue
+		}
+		value, ok := envFileVersion(envFiles, env, variable)
+		if !ok {
+			continue
+		}
+		isRange := IsVersionRange(value)
+		if !isRange && !(resolvePartial && IsPartialVersion(value)) {
+			continue
+		}
+
+		versionService := versionServiceOf(rawProject, rawService, variable)
+		if versionService == "" {
+			if isRange {
+				return fmt.Errorf("cannot resolve %s=%s: no command uses %s as its version", variable, value, variable)
+			}
+			continue
+		}
+
+		resolved, err := resolver.Resolve(ctx, composeFilePaths, env, versionService, variable, value)
+		if err != nil {
+			if isRange {
+				return err
+			}
+			if warnings != nil {
+				fmt.Fprintf(warnings, "Warning: cannot resolve %s=%s, using it as is: %s\n", variable, value, err)
+			}
+			continue
+		}
+		if verbose {
+			fmt.Fprintf(out, "Resolved %s=%s to %s\n", variable, value, resolved)
+		}
+		env.Set(variable, resolved)
+	}
+	return nil
+}
+
+func hasUnresolvedEnvFileVersions(envFiles []EnvFile, resolvePartial bool) bool {
+	for _, envFile := range envFiles {
+		if filepath.Base(envFile.Path) != dockerizedEnvFileName {
+			continue
+		}
+		for variable, value := range envFile.Variables {
+			if strings.HasSuffix(variable, "_VERSION") && (IsVersionRange(value) || (resolvePartial && IsPartialVersion(value))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// envFileVersion returns the value of variable, if it is set by a dockerized.env file, and not overridden.
+func envFileVersion(envFiles []EnvFile, env *Environment, variable string) (string, bool) {
+	for i := len(envFiles) - 1; i >= 0; i-- {
+		value, ok := envFiles[i].Variables[variable]
+		if !ok {
+			continue
+		}
+		if filepath.Base(envFiles[i].Path) != dockerizedEnvFileName || value != env.Get(variable) {
+			return "", false
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// versionServiceOf returns the service whose version is set by variable, preferring service itself.
+func versionServiceOf(rawProject *types.Project, service types.ServiceConfig, variable string) string {
+	if versionVariable, err := getVersionVariable(service); err == nil && versionVariable == variable {
+		return service.Name
+	}
+	for _, other := range rawProject.Services {
+		if versionVariable, err := getVersionVariable(other); err == nil && versionVariable == variable {
+			return other.Name
+		}
+	}
+	return ""
+}
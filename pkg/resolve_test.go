@@ -0,0 +1,171 @@
+package dockerized_test
+
+import (
+	"context"
+	"errors"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+type countingVersionProvider struct {
+	versions []string
+	err      error
+	calls    int32
+}
+
+func (p *countingVersionProvider) ListVersions(context.Context, dockerized.VersionRequest) ([]string, error) {
+	atomic.AddInt32(&p.calls, 1)
+	return p.versions, p.err
+}
+
+// newResolveConfig writes a Compose File with an app, of which provider lists the versions. It returns the Config to
+// run it with runFake.
+func newResolveConfig(t *testing.T, provider dockerized.VersionProvider, env ...string) dockerized.Config {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := "services:\n  app:\n    image: \"app:${APP_VERSION}\"\n    x-dockerized:\n      versions:\n        source: custom\n        name: app\n"
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+	return dockerized.Config{
+		Env:              append([]string{"COMPOSE_FILE=" + composeFile}, env...),
+		VersionProviders: dockerized.VersionProviders{"custom": provider},
+	}
+}
+
+var appVersions = []string{"v0.9.0", "v1.0.0", "v1.0.1", "v1.2.0", "v1.2.3", "v2.0.0", "nightly"}
+
+func TestVersionConstraints(t *testing.T) {
+	tests := map[string]struct {
+		matches    []string
+		mismatches []string
+	}{
+		"16":          {matches: []string{"16", "16.0.1", "16.14.2"}, mismatches: []string{"15.9", "17.0.0"}},
+		"16.x":        {matches: []string{"16.14.2"}, mismatches: []string{"17.0.0"}},
+		"3.10":        {matches: []string{"3.10", "3.10.4"}, mismatches: []string{"3.9.9", "3.11.0"}},
+		"^16.2":       {matches: []string{"16.2.0", "16.14.2"}, mismatches: []string{"16.1.9", "17.0.0"}},
+		"^0.2.3":      {matches: []string{"0.2.3", "0.2.9"}, mismatches: []string{"0.2.2", "0.3.0"}},
+		"^0.0.3":      {matches: []string{"0.0.3"}, mismatches: []string{"0.0.4"}},
+		"~3.10":       {matches: []string{"3.10.0", "3.10.4"}, mismatches: []string{"3.11.0"}},
+		"~1.2.3":      {matches: []string{"1.2.3", "1.2.9"}, mismatches: []string{"1.2.2", "1.3.0"}},
+		"~1":          {matches: []string{"1.0.0", "1.9.0"}, mismatches: []string{"2.0.0"}},
+		"~> 1.2":      {matches: []string{"1.2.0", "1.9.0"}, mismatches: []string{"2.0.0"}},
+		">= 1.2, < 2": {matches: []string{"1.2.0", "1.9.9"}, mismatches: []string{"1.1.0", "2.0.0"}},
+	}
+	for spec, test := range tests {
+		constraints, err := dockerized.VersionConstraints(spec)
+		assert.Nil(t, err, spec)
+		for _, v := range test.matches {
+			assert.True(t, constraints.Check(version.Must(version.NewVersion(v))), "%s should match %s", spec, v)
+		}
+		for _, v := range test.mismatches {
+			assert.False(t, constraints.Check(version.Must(version.NewVersion(v))), "%s should not match %s", spec, v)
+		}
+	}
+
+	_, err := dockerized.VersionConstraints("^latest")
+	assert.NotNil(t, err)
+}
+
+func TestRunResolvesVersionRange(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	for spec, expected := range map[string]string{
+		"^1.0": "1.2.3",
+		"~1.0": "1.0.1",
+		"1":    "1.2.3",
+		"1.2":  "1.2.3",
+		"0":    "0.9.0",
+	} {
+		backend, _, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider), "app:"+spec)
+		assert.Nil(t, err, spec)
+		assert.Equal(t, "app:"+expected, backend.LastRun().Service.Image, spec)
+	}
+}
+
+func TestRunKeepsFullVersion(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	backend, _, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider), "app:1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:1.0.0", backend.LastRun().Service.Image)
+	assert.Equal(t, int32(0), provider.calls)
+}
+
+func TestRunReportsResolvedVersion(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	_, output, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider), "--verbose", "app:^1.0")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Resolved ^1.0 to 1.2.3\n")
+	assert.Contains(t, output, "Setting APP_VERSION to 1.2.3...\n")
+}
+
+func TestRunVersionRangeWithoutMatch(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	backend, _, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider), "app:^3")
+	assert.IsType(t, &dockerized.NoMatchingVersionError{}, err)
+	assert.Empty(t, backend.Runs())
+}
+
+func TestRunPartialVersionFallsBackWhenUnresolvable(t *testing.T) {
+	provider := &countingVersionProvider{err: errors.New("offline")}
+	backend, _, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider), "app:16")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:16", backend.LastRun().Service.Image)
+
+	_, _, err, _ = runFake(t, t.TempDir(), newResolveConfig(t, provider), "app:^16")
+	assert.EqualError(t, err, "offline")
+}
+
+func TestRunResolvesEnvFileVersion(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("APP_VERSION=~1.2\n"), 0644))
+
+	backend, output, err, _ := runFake(t, dir, newResolveConfig(t, provider), "--verbose", "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:1.2.3", backend.LastRun().Service.Image)
+	assert.Contains(t, output, "Resolved APP_VERSION=~1.2 to 1.2.3\n")
+
+	// The version on the command line takes precedence.
+	backend, _, err, _ = runFake(t, dir, newResolveConfig(t, provider), "app:1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:1.0.0", backend.LastRun().Service.Image)
+}
+
+func TestRunCachesVersions(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	home := t.TempDir()
+	for _, spec := range []string{"^1", "~1.0", "2"} {
+		_, _, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider, "HOME="+home), "app:"+spec)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(1), provider.calls)
+	entries, _ := os.ReadDir(filepath.Join(home, ".dockerized", "cache", "versions"))
+	assert.Len(t, entries, 1)
+}
+
+func TestRunKeepsPartialEnvFileVersion(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("APP_VERSION=1.2\n"), 0644))
+
+	// A partial version is a tag, which is used as is.
+	backend, _, err, _ := runFake(t, dir, newResolveConfig(t, provider), "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:1.2", backend.LastRun().Service.Image)
+	assert.Equal(t, int32(0), provider.calls)
+
+	// Unless resolving is enabled.
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("APP_VERSION=1.2\nDOCKERIZED_RESOLVE_VERSIONS=true\n"), 0644))
+	backend, _, err, _ = runFake(t, dir, newResolveConfig(t, provider), "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:1.2.3", backend.LastRun().Service.Image)
+	assert.Equal(t, int32(1), provider.calls)
+
+	// If the versions can't be listed, the partial version is used as is.
+	failing := &countingVersionProvider{err: errors.New("no network")}
+	backend, _, err, _ = runFake(t, dir, newResolveConfig(t, failing), "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app:1.2", backend.LastRun().Service.Image)
+}
@@ -0,0 +1,596 @@
+package dockerized
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/datastack-net/dockerized/pkg/help"
+	"github.com/datastack-net/dockerized/pkg/util"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/fatih/color"
+	"github.com/moby/term"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config configures a Runner.
+type Config struct {
+	// Root is the directory dockerized is installed in, containing the default .env and docker-compose.yml.
+	Root string
+	// Dir is the working directory on the host, in which commands are run.
+	Dir string
+	// Env is the environment, as `KEY=value` pairs. It takes precedence over the variables in .env files.
+	Env    []string
+	Stdin  io.ReadCloser
+	Stdout io.Writer
+	Stderr io.Writer
+	// Version is the version of dockerized, reported by --version.
+	Version string
+	// Backend runs the containers. Defaults to Docker Compose, attached to the streams above.
+	Backend Backend
+	// VersionProviders add to, or replace, the default version sources for `<command>:?`.
+	VersionProviders VersionProviders
+}
+
+// Streams are the standard streams of a command.
+type Streams struct {
+	Stdin  io.ReadCloser
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs dockerized commands. It does not modify the state of the process, such as the environment or the
+// working directory, so multiple commands can be run concurrently.
+type Runner struct {
+	config Config
+}
+
+// NewRunner creates a Runner. Unset fields in config default to the state of the current process.
+func NewRunner(config Config) *Runner {
+	if config.Root == "" {
+		config.Root = GetDockerizedRoot()
+	}
+	if config.Dir == "" {
+		config.Dir, _ = os.Getwd()
+	}
+	if config.Env == nil {
+		config.Env = os.Environ()
+	}
+	if config.Stdin == nil {
+		config.Stdin = os.Stdin
+	}
+	if config.Stdout == nil {
+		config.Stdout = os.Stdout
+	}
+	if config.Stderr == nil {
+		config.Stderr = os.Stderr
+	}
+	return &Runner{config: config}
+}
+
+// Run runs dockerized with the given command line arguments.
+func (r *Runner) Run(ctx context.Context, args []string) (err error, exitCode int) {
+	stdout := r.config.Stdout
+	// Verbose output goes to stderr, so it doesn't mix with the output of the command, e.g. `--output json`.
+	stderr := r.config.Stderr
+
+	dockerizedOptions, commandName, commandVersion, commandArgs, err := parseArguments(args)
+	if err != nil {
+		return err, ExitCode(err)
+	}
+
+	var optionHelp = util.HasKey(dockerizedOptions, OptionHelp) || util.HasKey(dockerizedOptions, ShortOptionHelp)
+	var optionVerbose = util.HasKey(dockerizedOptions, OptionVerbose) || util.HasKey(dockerizedOptions, ShortOptionVerbose)
+	var optionShell = util.HasKey(dockerizedOptions, OptionShell)
+	var optionBuild = util.HasKey(dockerizedOptions, OptionBuild)
+	var optionBuildPull = util.HasKey(dockerizedOptions, OptionBuildPull)
+	var optionBuildNoCache = util.HasKey(dockerizedOptions, OptionBuildNoCache)
+	var optionVersion = util.HasKey(dockerizedOptions, OptionVersion)
+	var optionPort = util.HasKey(dockerizedOptions, ShortOptionPort)
+	var optionEntrypoint = util.HasKey(dockerizedOptions, OptionEntrypoint)
+	var optionMapUser = util.HasKey(dockerizedOptions, OptionMapUser)
+	var optionTranslatePaths = util.HasKey(dockerizedOptions, OptionTranslatePaths)
+	var optionDryRun = util.HasKey(dockerizedOptions, OptionDryRun)
+	var optionOutput = util.HasKey(dockerizedOptions, OptionOutput)
+	var optionLatest = util.HasKey(dockerizedOptions, OptionLatest)
+	var optionLimit = util.HasKey(dockerizedOptions, OptionLimit)
+	var optionRefresh = util.HasKey(dockerizedOptions, OptionRefresh)
+	var optionOffline = util.HasKey(dockerizedOptions, OptionOffline)
+	var optionEndOfOptions = util.HasKey(dockerizedOptions, OptionEndOfOptions)
+
+	if !optionBuild {
+		if optionBuildPull {
+			return &UsageError{Message: fmt.Sprintf("%s option requires %s option", OptionBuildPull, OptionBuild)}, ExitCodeUsage
+		}
+		if optionBuildNoCache {
+			return &UsageError{Message: fmt.Sprintf("%s option requires %s option", OptionBuildNoCache, OptionBuild)}, ExitCodeUsage
+		}
+	}
+
+	outputFormat := OutputPlain
+	versionLimit := 0
+	for _, option := range []string{OptionOutput, OptionLatest, OptionLimit} {
+		if util.HasKey(dockerizedOptions, option) && commandVersion != "?" {
+			return &UsageError{Message: fmt.Sprintf("%s option requires <command>:?", option)}, ExitCodeUsage
+		}
+	}
+	if optionOutput {
+		outputFormat = dockerizedOptions[OptionOutput]
+		if !IsOutputFormat(outputFormat) {
+			return &UsageError{Message: fmt.Sprintf("%s option requires one of: %s, %s, %s", OptionOutput, OutputPlain, OutputJson, OutputYaml)}, ExitCodeUsage
+		}
+	}
+	if optionLimit {
+		versionLimit, err = strconv.Atoi(dockerizedOptions[OptionLimit])
+		if err != nil || versionLimit < 1 {
+			return &UsageError{Message: fmt.Sprintf("%s option requires a positive number", OptionLimit)}, ExitCodeUsage
+		}
+	}
+	if optionLatest {
+		versionLimit = 1
+	}
+
+	timings := NewTimings()
+	if optionVerbose {
+		defer timings.Print(stderr)
+	}
+
+	dockerizedRoot := r.config.Root
+	env := NewEnvironment(r.config.Env)
+	NormalizeEnvironment(env, dockerizedRoot)
+
+	if optionVerbose {
+		fmt.Fprintf(stderr, "Dockerized root: %s\n", dockerizedRoot)
+	}
+
+	if optionVersion {
+		fmt.Fprintf(stdout, "dockerized %s\n", r.config.Version)
+		return nil, 0
+	}
+
+	hostCwd := r.config.Dir
+	endPhase := timings.Track("load env files")
+	envFiles, err := LoadEnvFiles(env, dockerizedRoot, hostCwd)
+	endPhase()
+	if err != nil {
+		return err, 1
+	}
+
+	if optionVerbose {
+		for _, envFile := range envFiles {
+			fmt.Fprintf(stderr, "Loading: '%s'\n", envFile.Path)
+			if isVersionFile(envFile.Path) {
+				var names []string
+				for name := range envFile.Variables {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(stderr, "  %s=%s\n", name, envFile.Variables[name])
+				}
+			}
+		}
+	}
+
+	composeFilePaths := GetComposeFilePaths(dockerizedRoot, env)
+
+	if optionVerbose {
+		fmt.Fprintf(stderr, "Compose files: %s\n", strings.Join(composeFilePaths, ", "))
+	}
+
+	if !optionMapUser {
+		optionMapUser, _ = strconv.ParseBool(env.Get("DOCKERIZED_MAP_USER"))
+	}
+	if !optionTranslatePaths {
+		optionTranslatePaths, _ = strconv.ParseBool(env.Get("DOCKERIZED_TRANSLATE_PATHS"))
+	}
+
+	versionCache, err := NewVersionCache(env)
+	if err != nil {
+		return err, 1
+	}
+	versionCache.Refresh = optionRefresh
+	versionCache.Offline = versionCache.Offline || optionOffline
+	versionCache.Warnings = r.config.Stderr
+	resolver := &VersionResolver{
+		Providers: r.versionProviders(),
+		Cache:     versionCache,
+	}
+
+	if metaCommand, ok := getMetaCommand(commandName); ok && !optionHelp && !optionEndOfOptions {
+		if rawProject, err := getRawProject(composeFilePaths); err == nil && util.Contains(rawProject.ServiceNames(), commandName) {
+			fmt.Fprintf(r.config.Stderr, "Warning: the command %s in your Compose File is hidden by `dockerized %s`. Run it with: dockerized -- %s\n",
+				commandName, commandName, commandName)
+		}
+		err = metaCommand.Run(ctx, &metaContext{
+			Name:             commandName,
+			Command:          metaCommand,
+			Stdout:           stdout,
+			Stderr:           stderr,
+			Environ:          r.config.Env,
+			Env:              env,
+			EnvFiles:         envFiles,
+			ComposeFilePaths: composeFilePaths,
+			Root:             dockerizedRoot,
+			Dir:              hostCwd,
+			Verbose:          optionVerbose,
+			Resolver:         resolver,
+			NewBackend: func() (Backend, error) {
+				if r.config.Backend != nil {
+					return r.config.Backend, nil
+				}
+				return NewComposeBackend(Streams{Stdin: r.config.Stdin, Stdout: stdout, Stderr: r.config.Stderr})
+			},
+		}, commandArgs)
+		if errors.Is(err, errMetaHelp) {
+			return nil, 0
+		}
+		return err, ExitCode(err)
+	}
+
+	if commandVersion != "" && commandVersion != "?" && !optionHelp {
+		endPhase = timings.Track("set version")
+		err = SetCommandVersion(ctx, stderr, resolver, composeFilePaths, env, commandName, optionVerbose, commandVersion)
+		endPhase()
+		if err != nil {
+			return err, ExitCode(err)
+		}
+	}
+	if commandName != "" && commandVersion != "?" && !optionHelp {
+		endPhase = timings.Track("resolve versions")
+		err = ResolveEnvFileVersions(ctx, stderr, stderr, resolver, composeFilePaths, envFiles, env, commandName, optionVerbose)
+		endPhase()
+		if err != nil {
+			return err, ExitCode(err)
+		}
+	}
+
+	// The project is loaded once, after the environment is complete, and used for all further steps.
+	endPhase = timings.Track("load project")
+	project, err := GetProject(composeFilePaths, env)
+	endPhase()
+	if err != nil {
+		return err, 1
+	}
+
+	if commandName == "" || optionHelp {
+		err = help.Help(stdout, project, metaCommandHelp())
+		if err != nil {
+			return err, 1
+		}
+		if optionHelp {
+			return nil, 0
+		} else {
+			return nil, 1
+		}
+	}
+
+	if commandVersion == "?" {
+		rawVersions, err := ListCommandVersions(ctx, resolver.Providers, resolver.Cache, project, env, commandName)
+		if err != nil {
+			return err, ExitCode(err)
+		}
+		listing, err := NewVersionListing(commandName, rawVersions)
+		if err != nil {
+			return err, ExitCode(err)
+		}
+		listing.Current, err = GetConfiguredVersion(composeFilePaths, r.config.Env, envFiles, env, commandName)
+		if err != nil {
+			return err, ExitCode(err)
+		}
+		err = listing.Limit(versionLimit)
+		if err != nil {
+			return err, ExitCode(err)
+		}
+		err = PrintVersionListing(stdout, listing, outputFormat, optionVerbose)
+		return err, ExitCode(err)
+	}
+
+	hostName, _ := os.Hostname()
+	hostMount, containerCwd := GetHostMount(hostCwd, env.HomeDir())
+
+	if optionVerbose {
+		fmt.Fprintf(stderr, "Mounting: %s -> %s\n", hostMount.HostPath, hostMount.ContainerPath)
+	}
+
+	pathTranslator := NewPathTranslator(hostMount)
+	commandArgs = pathTranslator.ToContainerArgs(commandArgs)
+
+	streams := Streams{
+		Stdin:  r.config.Stdin,
+		Stdout: stdout,
+		Stderr: r.config.Stderr,
+	}
+	if optionTranslatePaths {
+		stdoutTranslator := pathTranslator.Writer(streams.Stdout)
+		stderrTranslator := pathTranslator.Writer(streams.Stderr)
+		defer stdoutTranslator.Flush()
+		defer stderrTranslator.Flush()
+		streams.Stdout = stdoutTranslator
+		streams.Stderr = stderrTranslator
+	}
+
+	backend := r.config.Backend
+	if optionDryRun {
+		backend = NewDryRunBackend(stdout)
+	} else if backend == nil {
+		endPhase = timings.Track("connect")
+		backend, err = NewComposeBackend(streams)
+		endPhase()
+		if err != nil {
+			return err, 1
+		}
+	}
+	if optionVerbose {
+		backend = &timedBackend{backend: backend, timings: timings}
+	}
+
+	runOptions := api.RunOptions{
+		Service: commandName,
+		Environment: []string{
+			"HOST_HOSTNAME=" + hostName,
+		},
+		Command:    commandArgs,
+		AutoRemove: true,
+		Tty:        isTerminal(stdout),
+		WorkingDir: containerCwd,
+	}
+
+	var serviceOptions []func(config *types.ServiceConfig) error
+
+	if optionPort {
+		var port = dockerizedOptions["-p"]
+		if port == "" {
+			return &UsageError{Message: "port option requires a port number"}, ExitCodeUsage
+		}
+		if optionVerbose {
+			fmt.Fprintf(stderr, "Mapping port: %s\n", port)
+		}
+		serviceOptions = append(serviceOptions, func(config *types.ServiceConfig) error {
+			if !strings.ContainsRune(port, ':') {
+				port = port + ":" + port
+			}
+			portConfig, err := types.ParsePortConfig(port)
+			if err != nil {
+				return err
+			}
+			config.Ports = portConfig
+			return nil
+		})
+	}
+
+	if optionMapUser {
+		hostUser := HostUser()
+		if hostUser == "" {
+			if optionVerbose {
+				fmt.Fprintf(stderr, "User mapping is not supported on this platform.\n")
+			}
+		} else {
+			if optionVerbose {
+				fmt.Fprintf(stderr, "Mapping user: %s\n", hostUser)
+			}
+			serviceOptions = append(serviceOptions, MapHostUser(hostUser))
+		}
+	}
+
+	volumes := []types.ServiceVolumeConfig{
+		{
+			Type:   "bind",
+			Source: hostMount.HostPath,
+			Target: hostMount.ContainerPath,
+		}}
+
+	var lockEntry LockEntry
+	locked := false
+	lockFilePath := projectLockFilePath(env)
+	if lockFilePath != "" {
+		lockFile, err := ReadLockFile(lockFilePath)
+		if err != nil {
+			return err, 1
+		}
+		lockEntry, locked = lockFile.Entry(commandName)
+	}
+
+	if !optionDryRun {
+		labelBuildInputs(ctx, backend, project, commandName, optionBuild || locked)
+	}
+
+	if optionBuild {
+		if optionVerbose {
+			fmt.Fprintf(stderr, "Building container image for %s...\n", commandName)
+		}
+		err := DockerComposeBuild(ctx, backend, project, api.BuildOptions{
+			Services: []string{commandName},
+			Pull:     optionBuildPull,
+			NoCache:  optionBuildNoCache,
+		})
+
+		if err != nil {
+			err = explainImageNotFound(ctx, resolver, composeFilePaths, project, env, commandName, err)
+			if errors.As(err, new(*VersionNotFoundError)) {
+				return err, ExitCode(err)
+			}
+			return err, 1
+		}
+	}
+
+	if optionShell && optionEntrypoint {
+		return &UsageError{Message: "--shell and --entrypoint are mutually exclusive"}, ExitCodeUsage
+	}
+
+	if optionShell {
+		if optionVerbose {
+			fmt.Fprintf(stderr, "Opening shell in container for %s...\n", commandName)
+
+			if len(commandArgs) > 0 {
+				fmt.Fprintf(stderr, "Passing arguments to shell: %s\n", commandArgs)
+			}
+		}
+
+		var ps1 = fmt.Sprintf(
+			"%s %s:\\w \\$ ",
+			color.BlueString("dockerized %s", commandName),
+			color.New(color.FgHiBlue).Add(color.Bold).Sprintf("\\u@\\h"),
+		)
+		var welcomeMessage = "Welcome to dockerized shell. Type 'exit' or press Ctrl+D to exit.\n"
+		welcomeMessage += "Mounted volumes:\n"
+
+		for _, volume := range volumes {
+			welcomeMessage += fmt.Sprintf("  %s -> %s\n", volume.Source, volume.Target)
+		}
+		service, err := project.GetService(commandName)
+		if err == nil {
+			for _, volume := range service.Volumes {
+				welcomeMessage += fmt.Sprintf("  %s -> %s\n", volume.Source, volume.Target)
+			}
+		}
+		welcomeMessage = strings.ReplaceAll(welcomeMessage, "\\", "\\\\")
+
+		shells := []string{
+			"bash",
+			"zsh",
+			"sh",
+		}
+		var shellDetectionCommands []string
+		for _, shell := range shells {
+			shellDetectionCommands = append(shellDetectionCommands, "command -v "+shell)
+		}
+		for _, shell := range shells {
+			shellDetectionCommands = append(shellDetectionCommands, "which "+shell)
+		}
+
+		var cmdPrintWelcome = fmt.Sprintf("echo '%s'", color.YellowString(welcomeMessage))
+		var cmdLaunchShell = fmt.Sprintf("$(%s)", strings.Join(shellDetectionCommands, " || "))
+
+		runOptions.Environment = append(runOptions.Environment, "PS1="+ps1)
+		runOptions.Entrypoint = []string{"/bin/sh"}
+
+		if len(commandArgs) > 0 {
+			runOptions.Command = []string{"-c", fmt.Sprintf("%s; %s \"%s\"", cmdPrintWelcome, cmdLaunchShell, strings.Join(commandArgs, "\" \""))}
+		} else {
+			runOptions.Command = []string{"-c", fmt.Sprintf("%s; %s", cmdPrintWelcome, cmdLaunchShell)}
+		}
+	}
+
+	if optionEntrypoint {
+		var entrypoint = dockerizedOptions["--entrypoint"]
+		if optionVerbose {
+			fmt.Fprintf(stderr, "Setting entrypoint to %s\n", entrypoint)
+		}
+		runOptions.Entrypoint = strings.Split(entrypoint, " ")
+	}
+
+	if !util.Contains(project.ServiceNames(), commandName) {
+		image := "r.j3ss.co/" + commandName
+		if optionVerbose {
+			fmt.Fprintf(stderr, "Service %s not found in compose file(s). Fallback to: %s.\n", commandName, image)
+			fmt.Fprintf(stderr, "  This command, if it exists, will not support version switching.\n")
+			fmt.Fprintf(stderr, "  See: https://github.com/jessfraz/dockerfiles\n")
+		}
+		return DockerRun(ctx, backend, image, runOptions, volumes, serviceOptions...)
+	}
+
+	if locked {
+		if optionVerbose {
+			fmt.Fprintf(stderr, "Using %s from %s\n", commandName, lockFilePath)
+		}
+		serviceOptions = append(serviceOptions, LockedImage(lockEntry, r.config.Stderr))
+	}
+
+	err, exitCode = DockerComposeRun(ctx, backend, project, runOptions, volumes, serviceOptions...)
+	if err != nil {
+		err = explainImageNotFound(ctx, resolver, composeFilePaths, project, env, commandName, err)
+		if errors.As(err, new(*VersionNotFoundError)) {
+			exitCode = ExitCode(err)
+		}
+	}
+	return err, exitCode
+}
+
+func (r *Runner) versionProviders() VersionProviders {
+	providers := DefaultVersionProviders()
+	for name, provider := range r.config.VersionProviders {
+		providers.Register(name, provider)
+	}
+	return providers
+}
+
+func parseArguments(args []string) (map[string]string, string, string, []string, error) {
+	var options = []string{
+		OptionBuild,
+		OptionBuildPull,
+		OptionBuildNoCache,
+		OptionDryRun,
+		OptionHelp,
+		ShortOptionHelp,
+		OptionLatest,
+		OptionLimit,
+		OptionOffline,
+		OptionOutput,
+		OptionRefresh,
+		ShortOptionPort,
+		OptionShell,
+		OptionEntrypoint,
+		OptionMapUser,
+		OptionTranslatePaths,
+		ShortOptionVerbose,
+		OptionVerbose,
+		OptionVersion,
+		OptionEndOfOptions,
+	}
+
+	var optionsWithParameters = []string{
+		"-p",
+		"--entrypoint",
+		OptionLimit,
+		OptionOutput,
+	}
+
+	commandName := ""
+	var commandArgs []string
+	var dockerizedOptions []string
+	var commandVersion string
+
+	var optionMap = make(map[string]string)
+	var optionBefore = ""
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && commandName == "" {
+			if util.Contains(options, arg) {
+				var option = arg
+				dockerizedOptions = append(dockerizedOptions, option)
+				optionBefore = option
+				optionMap[option] = ""
+			} else {
+				return nil, "", "", nil, &UnknownOptionError{Option: arg}
+			}
+		} else {
+			if util.Contains(optionsWithParameters, optionBefore) {
+				optionMap[optionBefore] = arg
+			} else if commandName == "" {
+				commandName = arg
+			} else {
+				commandArgs = append(commandArgs, arg)
+			}
+			optionBefore = ""
+		}
+	}
+	if strings.ContainsRune(commandName, ':') {
+		commandSplit := strings.Split(commandName, ":")
+		commandName = commandSplit[0]
+		commandVersion = commandSplit[1]
+		if commandVersion == "" {
+			commandVersion = "?"
+		}
+	}
+	return optionMap, commandName, commandVersion, commandArgs, nil
+}
+
+func isTerminal(stream interface{}) bool {
+	file, ok := stream.(*os.File)
+	return ok && term.IsTerminal(file.Fd())
+}
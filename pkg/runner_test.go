@@ -0,0 +1,305 @@
+package dockerized_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/compose-spec/compose-go/types"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/datastack-net/dockerized/pkg/fake"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// runFake runs dockerized in dir, with an empty home directory and the fake backend. The fields set in config replace
+// these defaults, except Env, which is added to the environment. The output of Stdout and Stderr is returned together,
+// unless config sets them.
+func runFake(t *testing.T, dir string, config dockerized.Config, args ...string) (*fake.Backend, string, error, int) {
+	root, err := filepath.Abs("..")
+	assert.Nil(t, err)
+	if config.Root == "" {
+		config.Root = root
+	}
+	config.Dir = dir
+	config.Env = append([]string{"HOME=" + t.TempDir()}, config.Env...)
+	var output bytes.Buffer
+	if config.Stdout == nil {
+		config.Stdout = &output
+	}
+	if config.Stderr == nil {
+		config.Stderr = &output
+	}
+	if config.Backend == nil {
+		config.Backend = &fake.Backend{}
+	}
+	backend, _ := config.Backend.(*fake.Backend)
+	err, exitCode := dockerized.NewRunner(config).Run(context.Background(), args)
+	return backend, output.String(), err, exitCode
+}
+
+func TestRunMountsWorkingDirectory(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	backend, _, err, exitCode := runFake(t, dir, dockerized.Config{}, "go", "version")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+
+	run := backend.LastRun()
+	containerDir := "/host/" + filepath.Base(dir)
+	assert.Equal(t, []string{"version"}, run.Options.Command)
+	assert.Equal(t, containerDir, run.Options.WorkingDir)
+	assert.Contains(t, run.Service.Volumes, types.ServiceVolumeConfig{Type: "bind", Source: dir, Target: containerDir})
+	assert.Len(t, backend.Networks(), 1)
+}
+
+func TestRunDefaultVersion(t *testing.T) {
+	t.Parallel()
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "go", "version")
+	assert.Nil(t, err)
+	assert.Equal(t, "golang:1.17.8", backend.LastRun().Service.Image)
+}
+
+func TestRunVersionOverride(t *testing.T) {
+	t.Parallel()
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "go:1.16.5", "version")
+	assert.Nil(t, err)
+	assert.Equal(t, "golang:1.16.5", backend.LastRun().Service.Image)
+}
+
+func TestRunProjectEnvFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("GO_VERSION=1.15.0\n"), 0644)
+	assert.Nil(t, err)
+	subDir := filepath.Join(dir, "sub")
+	assert.Nil(t, os.Mkdir(subDir, 0755))
+
+	backend, _, err, _ := runFake(t, subDir, dockerized.Config{}, "go", "version")
+	assert.Nil(t, err)
+	run := backend.LastRun()
+	assert.Equal(t, "golang:1.15.0", run.Service.Image)
+	assert.Equal(t, "/host/"+filepath.Base(dir)+"/sub", run.Options.WorkingDir)
+}
+
+func TestRunEnvironmentOverridesEnvFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("GO_VERSION=1.15.0\n"), 0644)
+	assert.Nil(t, err)
+
+	backend, _, err, _ := runFake(t, dir, dockerized.Config{Env: []string{"GO_VERSION=1.14.0"}}, "go", "version")
+	assert.Nil(t, err)
+	assert.Equal(t, "golang:1.14.0", backend.LastRun().Service.Image)
+}
+
+func TestRunPortOption(t *testing.T) {
+	t.Parallel()
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "-p", "8080", "go", "version")
+	assert.Nil(t, err)
+	ports := backend.LastRun().Service.Ports
+	assert.Len(t, ports, 1)
+	assert.Equal(t, uint32(8080), ports[0].Target)
+	assert.Equal(t, "8080", ports[0].Published)
+}
+
+func TestRunMapUserOption(t *testing.T) {
+	t.Parallel()
+	if dockerized.HostUser() == "" {
+		t.Skip("user mapping is not supported on this platform")
+	}
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "--map-user", "go", "version")
+	assert.Nil(t, err)
+	assert.Equal(t, dockerized.HostUser(), backend.LastRun().Service.User)
+}
+
+func TestRunUnknownCommandFallsBackToImage(t *testing.T) {
+	t.Parallel()
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "cowsay", "hello")
+	assert.Nil(t, err)
+	run := backend.LastRun()
+	assert.Equal(t, "r.j3ss.co/cowsay", run.Service.Image)
+	assert.Equal(t, []string{"hello"}, run.Options.Command)
+}
+
+func TestRunBuildOption(t *testing.T) {
+	t.Parallel()
+	backend, _, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "--build", "--no-cache", "go", "version")
+	assert.Nil(t, err)
+	builds := backend.Builds()
+	assert.Len(t, builds, 1)
+	assert.Equal(t, []string{"go"}, builds[0].Options.Services)
+	assert.True(t, builds[0].Options.NoCache)
+}
+
+func TestRunPassesExitCode(t *testing.T) {
+	t.Parallel()
+	_, _, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{Backend: &fake.Backend{ExitCode: 3}}, "go", "version")
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, exitCode)
+}
+
+func TestRunConcurrently(t *testing.T) {
+	t.Parallel()
+	backend := &fake.Backend{}
+	home := t.TempDir()
+
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			_, _, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{
+				Env:     []string{"HOME=" + home, "GO_VERSION=1.17." + strconv.Itoa(i)},
+				Backend: backend,
+			}, "go", "version")
+			assert.Nil(t, err)
+			assert.Equal(t, 0, exitCode)
+		}(i)
+	}
+	wait.Wait()
+
+	runs := backend.Runs()
+	assert.Len(t, runs, 20)
+	images := map[string]bool{}
+	for _, run := range runs {
+		images[run.Service.Image] = true
+	}
+	assert.Len(t, images, 20)
+}
+
+func TestRunVerbosePrintsTimings(t *testing.T) {
+	t.Parallel()
+	_, output, err, _ := runFake(t, t.TempDir(), dockerized.Config{}, "--verbose", "go", "version")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Timings:")
+	assert.Contains(t, output, "load project")
+	assert.Contains(t, output, "run container")
+}
+
+// BenchmarkRun measures the overhead of dockerized itself, without running a container.
+func BenchmarkRun(b *testing.B) {
+	root, _ := filepath.Abs("..")
+	dir := b.TempDir()
+	runner := dockerized.NewRunner(dockerized.Config{
+		Root:    root,
+		Dir:     dir,
+		Env:     []string{"HOME=" + dir},
+		Stdout:  io.Discard,
+		Backend: &fake.Backend{},
+	})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err, _ := runner.Run(context.Background(), []string{"go", "version"})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	backend, output, err, exitCode := runFake(t, dir, dockerized.Config{}, "--dry-run", "go:1.16.5", "build", "./...")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Empty(t, backend.Runs())
+
+	containerDir := "/host/" + filepath.Base(dir)
+	assert.Contains(t, output, "image: golang:1.16.5")
+	assert.Contains(t, output, "docker run --rm -i")
+	assert.Contains(t, output, "-v "+dir+":"+containerDir)
+	assert.Contains(t, output, "--workdir "+containerDir)
+	assert.Contains(t, output, "--entrypoint go golang:1.16.5 build ./...")
+}
+
+func TestDockerRunCommandQuotesArguments(t *testing.T) {
+	t.Parallel()
+	var output bytes.Buffer
+	project := &types.Project{
+		Name:     "dockerized",
+		Services: types.Services{{Name: "sh", Image: "alpine"}},
+	}
+	backend := dockerized.NewDryRunBackend(&output)
+	_, err := backend.RunOneOffContainer(context.Background(), project, api.RunOptions{
+		Service:    "sh",
+		Entrypoint: []string{"sh", "-c"},
+		Command:    []string{"echo 'hello world'"},
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, output.String(), `--entrypoint sh alpine -c 'echo '"'"'hello world'"'"''`)
+}
+
+func TestEnvExplain(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "dockerized.env")
+	err := os.WriteFile(envFile, []byte("# Project settings\nGO_VERSION=1.15.0\nNODE_VERSION=16.0.0\n"), 0644)
+	assert.Nil(t, err)
+
+	backend, output, err, exitCode := runFake(t, dir, dockerized.Config{Env: []string{"NODE_VERSION=15.0.0"}}, "env", "--explain", "GO_VERSION", "NODE_VERSION")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Empty(t, backend.Runs())
+
+	root, _ := filepath.Abs("..")
+	defaultEnvFile := filepath.Join(root, ".env")
+	assert.Contains(t, output, "GO_VERSION=1.15.0\n  set in:     "+envFile+":2\n  overrides:  "+defaultEnvFile+":")
+	assert.Contains(t, output, "NODE_VERSION=15.0.0\n  set in:     environment\n  overrides:  "+envFile+":3 (16.0.0)\n")
+	assert.Regexp(t, `used by: .*\bgo\b`, output)
+
+	// Variables interpolated in volumes are used, the names of environment variables of containers are not.
+	_, output, err, _ = runFake(t, dir, dockerized.Config{}, "env", "--explain", "HOME", "SA_PASSWORD", "ACCEPT_EULA")
+	assert.Nil(t, err)
+	assert.Regexp(t, `HOME=[^\n]*\n(  .*\n)*  used by: .*\baws\b.*\bgh\b`, output)
+	assert.Regexp(t, `SA_PASSWORD=[^\n]*\n(  .*\n)*  used by:    mssql\n`, output)
+	assert.True(t, strings.HasSuffix(output, "ACCEPT_EULA (not set)\n"), output)
+}
+
+func TestEnvList(t *testing.T) {
+	t.Parallel()
+	_, output, err, _ := runFake(t, t.TempDir(), dockerized.Config{Env: []string{"GO_VERSION=1.14.0"}}, "env")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "\nGO_VERSION=1.14.0\n")
+	assert.Contains(t, output, "\nNODE_VERSION=")
+}
+
+func TestEnvUnknownFlag(t *testing.T) {
+	t.Parallel()
+	_, _, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{}, "env", "--unknown")
+	assert.NotNil(t, err)
+	assert.Equal(t, dockerized.ExitCodeUsage, exitCode)
+}
+
+func TestRunServiceHiddenByDockerizedCommand(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, _, err, _ := runFake(t, dir, dockerized.Config{}, "init")
+	assert.Nil(t, err)
+	composeFile := "services:\n  env:\n    image: alpine\n    entrypoint: [\"env\"]\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(composeFile), 0644))
+
+	// The dockerized command runs, with a warning.
+	backend, output, err, _ := runFake(t, dir, dockerized.Config{}, "env")
+	assert.Nil(t, err)
+	assert.Empty(t, backend.Runs())
+	assert.Contains(t, output, "Warning: the command env in your Compose File is hidden by `dockerized env`. Run it with: dockerized -- env\n")
+	assert.Contains(t, output, "\nNODE_VERSION=")
+
+	// The service runs after --.
+	backend, output, err, _ = runFake(t, dir, dockerized.Config{}, "--", "env", "-0")
+	assert.Nil(t, err)
+	assert.NotContains(t, output, "Warning")
+	assert.Equal(t, "alpine", backend.LastRun().Service.Image)
+	assert.Equal(t, []string{"-0"}, backend.LastRun().Options.Command)
+
+	// Without a service with the same name, there's no warning.
+	_, output, err, _ = runFake(t, t.TempDir(), dockerized.Config{}, "env")
+	assert.Nil(t, err)
+	assert.NotContains(t, output, "Warning")
+}
@@ -0,0 +1,80 @@
+package dockerized
+
+import (
+	"context"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/compose/v2/pkg/api"
+	moby "github.com/docker/docker/api/types"
+	"io"
+	"sync"
+	"time"
+)
+
+// Timings records how long each phase of a run takes, to report it with --verbose.
+type Timings struct {
+	mutex  sync.Mutex
+	start  time.Time
+	phases []Phase
+}
+
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+func NewTimings() *Timings {
+	return &Timings{start: time.Now()}
+}
+
+// Track starts a phase, and returns the function that ends it.
+//
+//	defer timings.Track("load project")()
+func (t *Timings) Track(name string) func() {
+	start := time.Now()
+	return func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.phases = append(t.phases, Phase{Name: name, Duration: time.Since(start)})
+	}
+}
+
+func (t *Timings) Phases() []Phase {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]Phase{}, t.phases...)
+}
+
+func (t *Timings) Print(out io.Writer) {
+	fmt.Fprintf(out, "Timings:\n")
+	for _, phase := range t.Phases() {
+		fmt.Fprintf(out, "  %-20s %s\n", phase.Name, phase.Duration.Round(time.Microsecond))
+	}
+	fmt.Fprintf(out, "  %-20s %s\n", "total", time.Since(t.start).Round(time.Microsecond))
+}
+
+// timedBackend records the duration of the calls to backend.
+type timedBackend struct {
+	backend Backend
+	timings *Timings
+}
+
+func (b *timedBackend) Build(ctx context.Context, project *types.Project, options api.BuildOptions) error {
+	defer b.timings.Track("build")()
+	return b.backend.Build(ctx, project, options)
+}
+
+func (b *timedBackend) SetupNetwork(ctx context.Context, project *types.Project) error {
+	defer b.timings.Track("set up network")()
+	return b.backend.SetupNetwork(ctx, project)
+}
+
+func (b *timedBackend) RunOneOffContainer(ctx context.Context, project *types.Project, options api.RunOptions) (int, error) {
+	defer b.timings.Track("run container")()
+	return b.backend.RunOneOffContainer(ctx, project, options)
+}
+
+func (b *timedBackend) InspectImage(ctx context.Context, image string) (moby.ImageInspect, error) {
+	defer b.timings.Track("inspect image")()
+	return b.backend.InspectImage(ctx, image)
+}
@@ -0,0 +1,203 @@
+package dockerized
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/datastack-net/dockerized/pkg/util"
+	"github.com/hashicorp/go-version"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Upgrade policies, for `dockerized upgrade --policy`.
+const (
+	UpgradePatch = "patch"
+	UpgradeMinor = "minor"
+	UpgradeMajor = "major"
+)
+
+// VersionUpgrade is a change of a version variable in a dockerized.env file.
+type VersionUpgrade struct {
+	Variable string
+	// Line is the line number of the variable in the file.
+	Line int
+	From string
+	To   string
+	// OldLine and NewLine are the full lines in the file, before and after the upgrade.
+	OldLine string
+	NewLine string
+}
+
+// SkippedUpgrade is a version variable that couldn't be upgraded, e.g. because its versions can't be listed.
+type SkippedUpgrade struct {
+	Variable string
+	Err      error
+}
+
+// envFileVersionLinePattern matches `NAME=value` lines, capturing the value without quotes, and everything around it.
+var envFileVersionLinePattern = regexp.MustCompile(`^(\s*(?:export\s+)?([A-Za-z0-9_]+_VERSION)\s*=\s*)(["']?)([^"'\s#]*)(["']?)(.*)$`)
+
+// UpgradeEnvFileVersions returns the upgrades of the *_VERSION variables in content to the latest version allowed by
+// policy, and the upgraded content. Comments, ordering and quoting are preserved. Values that are not versions, such
+// as `latest` or ranges, are not changed. Partial versions keep their number of segments, e.g. 3.10 becomes 3.11.
+// If commandNames is not empty, only the versions of those commands are upgraded.
+// Variables whose versions can't be listed are skipped, and returned separately, so the others are still upgraded.
+func UpgradeEnvFileVersions(ctx context.Context, resolver *VersionResolver, rawProject *types.Project, project *types.Project, env *Environment, content string, policy string, commandNames []string) ([]VersionUpgrade, []SkippedUpgrade, string, error) {
+	lines := strings.Split(content, "\n")
+	var upgrades []VersionUpgrade
+	var skipped []SkippedUpgrade
+	for index, line := range lines {
+		match := envFileVersionLinePattern.FindStringSubmatch(line)
+		if match == nil || match[3] != match[5] {
+			continue
+		}
+		variable, value := match[2], match[4]
+		current, err := version.NewVersion(value)
+		if err != nil || IsVersionRange(value) {
+			continue
+		}
+
+		rawService, ok := findVersionService(rawProject, variable)
+		if !ok || (len(commandNames) > 0 && !util.Contains(commandNames, rawService.Name)) {
+			continue
+		}
+		service, err := project.GetService(rawService.Name)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		rawVersions, err := listServiceVersions(ctx, resolver.Providers, resolver.Cache, service, env)
+		if err != nil {
+			skipped = append(skipped, SkippedUpgrade{Variable: variable, Err: err})
+			continue
+		}
+		semanticVersions, _ := getSemanticVersions(rawVersions)
+		sortVersions(semanticVersions)
+
+		patch, minor, major := latestVersions(current, semanticVersions)
+		latest := map[string]string{UpgradePatch: patch, UpgradeMinor: minor, UpgradeMajor: major}[policy]
+		latest = truncateVersion(latest, len(versionSegmentPattern.FindAllString(value, -1)))
+		latestVersion, err := version.NewVersion(latest)
+		if err != nil || !latestVersion.GreaterThan(current) {
+			continue
+		}
+
+		newLine := match[1] + match[3] + latest + match[5] + match[6]
+		upgrades = append(upgrades, VersionUpgrade{
+			Variable: variable,
+			Line:     index + 1,
+			From:     value,
+			To:       latest,
+			OldLine:  line,
+			NewLine:  newLine,
+		})
+		lines[index] = newLine
+	}
+	return upgrades, skipped, strings.Join(lines, "\n"), nil
+}
+
+// findVersionService returns the service whose version is set by variable.
+func findVersionService(rawProject *types.Project, variable string) (types.ServiceConfig, bool) {
+	for _, service := range rawProject.Services {
+		if versionVariable, err := getVersionVariable(service); err == nil && versionVariable == variable && usesVariable(service, variable) {
+			return service, true
+		}
+	}
+	return types.ServiceConfig{}, false
+}
+
+// truncateVersion returns the first n segments of v, e.g. 3.11 for 3.11.2 and n = 2.
+func truncateVersion(v string, n int) string {
+	segments := strings.Split(v, ".")
+	if n > 0 && n < len(segments) {
+		segments = segments[:n]
+	}
+	return strings.Join(segments, ".")
+}
+
+func runUpgradeCommand(ctx context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	global := flags.Bool("global", false, "Upgrade the global dockerized.env in your home directory, instead of the project's.")
+	policy := flags.String("policy", UpgradeMinor, "Upgrade to the latest patch, minor or major version.")
+	dryRun := flags.Bool("dry-run", false, "Print the changes as a diff, without writing them.")
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+	switch *policy {
+	case UpgradePatch, UpgradeMinor, UpgradeMajor:
+	default:
+		return &UsageError{Message: fmt.Sprintf("unsupported policy: %s\nUsage: dockerized %s", *policy, meta.Command.Usage)}
+	}
+
+	var envFilePath string
+	if *global {
+		envFilePath = filepath.Join(meta.Env.HomeDir(), dockerizedEnvFileName)
+	} else {
+		projectEnvFile, err := findProjectEnvFileBelowHome(meta.Dir, meta.Env.HomeDir())
+		if err != nil {
+			return fmt.Errorf("%w, use --global", err)
+		}
+		envFilePath = projectEnvFile
+	}
+	fileInfo, err := os.Stat(envFilePath)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(envFilePath)
+	if err != nil {
+		return err
+	}
+
+	rawProject, err := getRawProject(meta.ComposeFilePaths)
+	if err != nil {
+		return err
+	}
+	project, err := meta.GetProject()
+	if err != nil {
+		return err
+	}
+	for _, name := range flags.Args() {
+		if _, err := rawProject.GetService(name); err != nil {
+			return err
+		}
+	}
+
+	upgrades, skipped, upgraded, err := UpgradeEnvFileVersions(ctx, meta.Resolver, rawProject, project, meta.Env, string(content), *policy, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	out := meta.Stdout
+	var skippedErr error
+	if len(skipped) > 0 {
+		for _, skippedUpgrade := range skipped {
+			fmt.Fprintf(out, "Skipped %s: %s\n", skippedUpgrade.Variable, skippedUpgrade.Err)
+		}
+		skippedErr = &UpgradeSkippedError{Skipped: skipped}
+	}
+	if len(upgrades) == 0 {
+		if skippedErr == nil {
+			fmt.Fprintf(out, "All versions in %s are up to date.\n", envFilePath)
+		}
+		return skippedErr
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "--- %s\n+++ %s\n", envFilePath, envFilePath)
+		for _, upgrade := range upgrades {
+			fmt.Fprintf(out, "@@ -%d +%d @@\n-%s\n+%s\n", upgrade.Line, upgrade.Line, upgrade.OldLine, upgrade.NewLine)
+		}
+		return skippedErr
+	}
+
+	if err = os.WriteFile(envFilePath, []byte(upgraded), fileInfo.Mode().Perm()); err != nil {
+		return err
+	}
+	for _, upgrade := range upgrades {
+		fmt.Fprintf(out, "%s: %s -> %s\n", upgrade.Variable, upgrade.From, upgrade.To)
+	}
+	fmt.Fprintf(out, "Upgraded %s\n", envFilePath)
+	return skippedErr
+}
@@ -0,0 +1,134 @@
+package dockerized_test
+
+import (
+	"context"
+	"errors"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const upgradeEnvFile = `# Versions of the project
+APP_VERSION="1.0.0" # pinned for the release
+export TOOL_VERSION=1.0
+WEB_VERSION=latest
+OTHER=1.0.0
+`
+
+// newUpgradeConfig writes a Compose File with commands, of which provider lists the versions. It returns the Config to
+// run it with runFake.
+func newUpgradeConfig(t *testing.T, provider dockerized.VersionProvider, env ...string) dockerized.Config {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := `services:
+  app:
+    image: "app:${APP_VERSION}"
+    x-dockerized:
+      versions: {source: custom, name: app}
+  tool:
+    image: "tool:${TOOL_VERSION}"
+    x-dockerized:
+      versions: {source: custom, name: tool}
+  web:
+    image: "web:${WEB_VERSION}"
+    x-dockerized:
+      versions: {source: custom, name: web}
+`
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+	return dockerized.Config{
+		Env:              append([]string{"COMPOSE_FILE=" + composeFile}, env...),
+		VersionProviders: dockerized.VersionProviders{"custom": provider},
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	for policy, expected := range map[string]string{
+		"patch": "# Versions of the project\nAPP_VERSION=\"1.0.1\" # pinned for the release\nexport TOOL_VERSION=1.0\nWEB_VERSION=latest\nOTHER=1.0.0\n",
+		"minor": "# Versions of the project\nAPP_VERSION=\"1.2.3\" # pinned for the release\nexport TOOL_VERSION=1.2\nWEB_VERSION=latest\nOTHER=1.0.0\n",
+		"major": "# Versions of the project\nAPP_VERSION=\"2.0.0\" # pinned for the release\nexport TOOL_VERSION=2.0\nWEB_VERSION=latest\nOTHER=1.0.0\n",
+	} {
+		dir := t.TempDir()
+		envFile := filepath.Join(dir, "dockerized.env")
+		assert.Nil(t, os.WriteFile(envFile, []byte(upgradeEnvFile), 0600))
+
+		_, _, err, _ := runFake(t, dir, newUpgradeConfig(t, staticVersionProvider(appVersions)), "upgrade", "--policy", policy)
+		assert.Nil(t, err, policy)
+		content, _ := os.ReadFile(envFile)
+		assert.Equal(t, expected, string(content), policy)
+		info, _ := os.Stat(envFile)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestUpgradeDryRun(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "dockerized.env")
+	assert.Nil(t, os.WriteFile(envFile, []byte(upgradeEnvFile), 0644))
+
+	_, output, err, _ := runFake(t, dir, newUpgradeConfig(t, staticVersionProvider(appVersions)), "upgrade", "--dry-run", "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "--- "+envFile+"\n+++ "+envFile+"\n"+
+		"@@ -2 +2 @@\n"+
+		"-APP_VERSION=\"1.0.0\" # pinned for the release\n"+
+		"+APP_VERSION=\"1.2.3\" # pinned for the release\n", output)
+	content, _ := os.ReadFile(envFile)
+	assert.Equal(t, upgradeEnvFile, string(content))
+}
+
+func TestUpgradeGlobal(t *testing.T) {
+	home := t.TempDir()
+	envFile := filepath.Join(home, "dockerized.env")
+	assert.Nil(t, os.WriteFile(envFile, []byte("APP_VERSION=2.0.0\n"), 0644))
+
+	_, output, err, _ := runFake(t, t.TempDir(), newUpgradeConfig(t, staticVersionProvider(appVersions), "HOME="+home), "upgrade", "--global")
+	assert.Nil(t, err)
+	assert.Equal(t, "All versions in "+envFile+" are up to date.\n", output)
+}
+
+func TestUpgradeRequiresGlobalOutsideProject(t *testing.T) {
+	home := t.TempDir()
+	envFile := filepath.Join(home, "dockerized.env")
+	assert.Nil(t, os.WriteFile(envFile, []byte("APP_VERSION=1.0.0\n"), 0644))
+	dir := filepath.Join(home, "src")
+	assert.Nil(t, os.Mkdir(dir, 0755))
+
+	_, _, err, _ := runFake(t, dir, newUpgradeConfig(t, staticVersionProvider(appVersions), "HOME="+home), "upgrade")
+	assert.EqualError(t, err, "no project dockerized.env found, use --global")
+	content, _ := os.ReadFile(envFile)
+	assert.Equal(t, "APP_VERSION=1.0.0\n", string(content))
+}
+
+func TestUpgradeInvalidPolicy(t *testing.T) {
+	_, _, err, _ := runFake(t, t.TempDir(), newUpgradeConfig(t, staticVersionProvider(appVersions)), "upgrade", "--policy", "latest")
+	assert.IsType(t, &dockerized.UsageError{}, err)
+}
+
+// failingVersionProvider fails to list the versions of one package, and returns versions for the others.
+type failingVersionProvider struct {
+	name     string
+	versions []string
+}
+
+func (p failingVersionProvider) ListVersions(_ context.Context, request dockerized.VersionRequest) ([]string, error) {
+	if request.Name == p.name {
+		return nil, errors.New("unauthorized")
+	}
+	return p.versions, nil
+}
+
+func TestUpgradeSkipsVersionsThatCannotBeListed(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "dockerized.env")
+	assert.Nil(t, os.WriteFile(envFile, []byte(upgradeEnvFile), 0644))
+
+	_, output, err, _ := runFake(t, dir, newUpgradeConfig(t, failingVersionProvider{name: "tool", versions: appVersions}), "upgrade")
+	assert.NotNil(t, err)
+	assert.Equal(t, dockerized.ExitCodeError, dockerized.ExitCode(err))
+	assert.EqualError(t, err, "cannot upgrade TOOL_VERSION")
+	assert.Contains(t, output, "Skipped TOOL_VERSION: unauthorized\n")
+	assert.Contains(t, output, "APP_VERSION: 1.0.0 -> 1.2.3\n")
+
+	content, _ := os.ReadFile(envFile)
+	assert.Equal(t, "# Versions of the project\nAPP_VERSION=\"1.2.3\" # pinned for the release\nexport TOOL_VERSION=1.0\nWEB_VERSION=latest\nOTHER=1.0.0\n", string(content))
+}
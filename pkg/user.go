@@ -0,0 +1,43 @@
+package dockerized
+
+import (
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"os"
+)
+
+// Writable home directory for the mapped user. Most images only have a home directory for root.
+const mappedUserHome = "/dockerized/home"
+
+// HostUser returns the uid:gid of the current user, or "" when the platform has no numeric user ids (Windows).
+func HostUser() string {
+	uid := os.Getuid()
+	gid := os.Getgid()
+	if uid < 0 || gid < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", uid, gid)
+}
+
+// MapHostUser runs the service as the given host user, so files written to mounted directories are owned by
+// that user instead of root. Services opt out with `x-dockerized: { map_user: false }`.
+func MapHostUser(user string) func(config *types.ServiceConfig) error {
+	return func(config *types.ServiceConfig) error {
+		extension, err := GetServiceExtension(*config)
+		if err != nil {
+			return err
+		}
+		if extension.MapUser != nil && !*extension.MapUser {
+			return nil
+		}
+
+		home := mappedUserHome
+		config.User = user
+		config.Tmpfs = append(config.Tmpfs, mappedUserHome+":rw,exec,mode=1777")
+		if config.Environment == nil {
+			config.Environment = types.MappingWithEquals{}
+		}
+		config.Environment["HOME"] = &home
+		return nil
+	}
+}
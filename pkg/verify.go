@@ -0,0 +1,206 @@
+package dockerized
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/errdefs"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Statuses of the local image of a command, compared to dockerized.lock.
+const (
+	VerifyOk         = "ok"
+	VerifyMissing    = "missing"
+	VerifyMismatched = "mismatched"
+	VerifyUnpinned   = "unpinned"
+)
+
+// ImageVerification is the status of the local image of a command, compared to its entry in dockerized.lock.
+type ImageVerification struct {
+	Command string
+	Status  string
+	// Detail is the locked image if the status is VerifyOk, and explains the status otherwise.
+	Detail string
+}
+
+// VerifyImages compares the local images of the services with their entries in lockFile. A nil lockFile has no
+// entries, so all services are unpinned.
+func VerifyImages(ctx context.Context, backend Backend, project *types.Project, lockFile *LockFile, serviceNames []string) ([]ImageVerification, error) {
+	var verifications []ImageVerification
+	for _, name := range serviceNames {
+		service, err := project.GetService(name)
+		if err != nil {
+			return nil, err
+		}
+		verification, err := verifyImage(ctx, backend, project, service, lockFile)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, verification)
+	}
+	return verifications, nil
+}
+
+func verifyImage(ctx context.Context, backend Backend, project *types.Project, service types.ServiceConfig, lockFile *LockFile) (ImageVerification, error) {
+	verification := ImageVerification{Command: service.Name}
+	entry, ok := lockFile.Entry(service.Name)
+	switch {
+	case !ok:
+		verification.Status, verification.Detail = VerifyUnpinned, "not in "+lockFileName
+		return verification, nil
+	case entry.Image != service.Image:
+		verification.Status, verification.Detail = VerifyMismatched, fmt.Sprintf("locked to %s, but %s is configured", entry.Image, service.Image)
+		return verification, nil
+	case service.Build != nil:
+		return verifyBuiltImage(ctx, backend, project, service, entry)
+	case entry.Digest == "":
+		verification.Status, verification.Detail = VerifyUnpinned, "no digest in "+lockFileName
+		return verification, nil
+	}
+
+	ref, err := reference.ParseDockerRef(service.Image)
+	if err != nil {
+		return verification, err
+	}
+	pinned, err := reference.ParseNormalizedNamed(reference.TrimNamed(ref).String() + "@" + entry.Digest)
+	if err != nil {
+		return verification, fmt.Errorf("invalid digest of %s in %s: %w", service.Name, lockFileName, err)
+	}
+
+	_, err = backend.InspectImage(ctx, reference.FamiliarString(pinned))
+	if err == nil {
+		verification.Status, verification.Detail = VerifyOk, service.Image+"@"+entry.Digest
+		return verification, nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return verification, err
+	}
+
+	local, err := backend.InspectImage(ctx, service.Image)
+	if errdefs.IsNotFound(err) {
+		verification.Status, verification.Detail = VerifyMissing, service.Image+" is not pulled"
+		return verification, nil
+	}
+	if err != nil {
+		return verification, err
+	}
+	verification.Status, verification.Detail = VerifyMismatched, fmt.Sprintf("local %s is %s", service.Image, localDigest(local.RepoDigests, local.ID))
+	return verification, nil
+}
+
+func verifyBuiltImage(ctx context.Context, backend Backend, project *types.Project, service types.ServiceConfig, entry LockEntry) (ImageVerification, error) {
+	verification := ImageVerification{Command: service.Name}
+	if entry.BuildHash == "" {
+		verification.Status, verification.Detail = VerifyUnpinned, "no build hash in "+lockFileName
+		return verification, nil
+	}
+	buildHash, err := BuildInputHash(*service.Build)
+	if err != nil {
+		return verification, err
+	}
+	if buildHash != entry.BuildHash {
+		verification.Status, verification.Detail = VerifyMismatched, "build inputs changed since they were locked"
+		return verification, nil
+	}
+
+	image := builtImageName(project, service)
+	local, err := backend.InspectImage(ctx, image)
+	if errdefs.IsNotFound(err) {
+		verification.Status, verification.Detail = VerifyMissing, image+" is not built"
+		return verification, nil
+	}
+	if err != nil {
+		return verification, err
+	}
+	var labels map[string]string
+	if local.Config != nil {
+		labels = local.Config.Labels
+	}
+	if labels[LabelBuildHash] != entry.BuildHash {
+		verification.Status, verification.Detail = VerifyMismatched, fmt.Sprintf("local %s is built from other inputs, rebuild it with --build", image)
+		return verification, nil
+	}
+	verification.Status, verification.Detail = VerifyOk, image+" (build "+entry.BuildHash+")"
+	return verification, nil
+}
+
+// localDigest returns the digest of a local image, or its ID if it wasn't pulled from a registry.
+func localDigest(repoDigests []string, id string) string {
+	for _, repoDigest := range repoDigests {
+		if index := strings.LastIndex(repoDigest, "@"); index >= 0 {
+			return repoDigest[index+1:]
+		}
+	}
+	return id
+}
+
+func runVerifyCommand(ctx context.Context, meta *metaContext, args []string) error {
+	flags := flag.NewFlagSet(meta.Name, flag.ContinueOnError)
+	if err := parseMetaFlags(meta, flags, args); err != nil {
+		return err
+	}
+
+	projectEnvFile, lockFilePath, err := findProjectLockFile(meta)
+	if err != nil {
+		return fmt.Errorf("cannot verify: %w", err)
+	}
+	lockFile, err := ReadLockFile(lockFilePath)
+	if err != nil {
+		return err
+	}
+
+	rawProject, err := getRawProject(meta.ComposeFilePaths)
+	if err != nil {
+		return err
+	}
+	project, err := meta.GetProject()
+	if err != nil {
+		return err
+	}
+
+	names := flags.Args()
+	if len(names) == 0 {
+		names, err = lockedServiceNames(rawProject, meta.ComposeFilePaths, projectEnvFile)
+		if err != nil {
+			return err
+		}
+		if lockFile != nil {
+			for name := range lockFile.Services {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		names = unique(names)
+	}
+
+	backend, err := meta.NewBackend()
+	if err != nil {
+		return err
+	}
+	verifications, err := VerifyImages(ctx, backend, project, lockFile, names)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	writer := tabwriter.NewWriter(meta.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "COMMAND\tSTATUS\tDETAIL\n")
+	for _, verification := range verifications {
+		if verification.Status != VerifyOk {
+			failed++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", verification.Command, verification.Status, verification.Detail)
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &VerifyError{Count: failed}
+	}
+	return nil
+}
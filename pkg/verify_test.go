@@ -0,0 +1,109 @@
+package dockerized_test
+
+import (
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/datastack-net/dockerized/pkg/fake"
+	moby "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// verifyConfig returns the Config to run the project of newLockProject with runFake, with the local images of backend.
+func verifyConfig(dir string, home string, backend *fake.Backend) dockerized.Config {
+	config := lockConfig(dir, home)
+	config.Backend = backend
+	return config
+}
+
+// lockedImages returns the local images that match the lock file of the project.
+func lockedImages(t *testing.T, dir string) map[string]moby.ImageInspect {
+	lockFile, err := dockerized.ReadLockFile(filepath.Join(dir, "dockerized.lock"))
+	assert.Nil(t, err)
+	app := lockFile.Services["app"]
+	tool := lockFile.Services["tool"]
+	return map[string]moby.ImageInspect{
+		strings.TrimSuffix(app.Image, ":1.0.0") + "@" + app.Digest: {ID: "sha256:app"},
+		"tool:1.0": {ID: "sha256:tool", Config: &container.Config{Labels: map[string]string{dockerized.LabelBuildHash: tool.BuildHash}}},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+
+	_, output, err, exitCode := runFake(t, dir, verifyConfig(dir, home, &fake.Backend{Images: lockedImages(t, dir)}), "verify")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Regexp(t, `app\s+ok\s+`, output)
+	assert.Regexp(t, `tool\s+ok\s+tool:1.0 \(build sha256:`, output)
+}
+
+func TestVerifyReportsMismatches(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock", "app")
+	assert.Nil(t, err)
+
+	lockFile, _ := dockerized.ReadLockFile(filepath.Join(dir, "dockerized.lock"))
+	backend := &fake.Backend{Images: map[string]moby.ImageInspect{
+		lockFile.Services["app"].Image: {ID: "sha256:other", RepoDigests: []string{"app@sha256:other"}},
+	}}
+	_, output, err, exitCode := runFake(t, dir, verifyConfig(dir, home, backend), "verify")
+	assert.NotNil(t, err)
+	assert.Equal(t, "2 commands don't match dockerized.lock", err.Error())
+	assert.Equal(t, 1, exitCode)
+	assert.Regexp(t, `app\s+mismatched\s+local .* is sha256:other`, output)
+	assert.Regexp(t, `tool\s+unpinned\s+not in dockerized.lock`, output)
+
+	_, _, err, _ = runFake(t, dir, verifyConfig(dir, home, &fake.Backend{}), "verify", "app")
+	assert.Equal(t, "1 command doesn't match dockerized.lock", err.Error())
+}
+
+func TestVerifyBuiltImage(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+
+	_, output, err, _ := runFake(t, dir, verifyConfig(dir, home, &fake.Backend{}), "verify", "tool")
+	assert.NotNil(t, err)
+	assert.Regexp(t, `tool\s+missing\s+tool:1.0 is not built`, output)
+
+	images := map[string]moby.ImageInspect{"tool:1.0": {ID: "sha256:tool"}}
+	_, output, err, _ = runFake(t, dir, verifyConfig(dir, home, &fake.Backend{Images: images}), "verify", "tool")
+	assert.NotNil(t, err)
+	assert.Regexp(t, `tool\s+mismatched\s+local tool:1.0 is built from other inputs`, output)
+
+	// A service without an image is built as <project>_<service>, where the project is named after its directory.
+	dir, home = newLockProject(t)
+	compose := "services:\n  tool:\n    build: ./tool\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(compose), 0644))
+	_, _, err, _ = runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+	image := filepath.Base(dir) + "_tool"
+
+	_, output, err, _ = runFake(t, dir, verifyConfig(dir, home, &fake.Backend{}), "verify", "tool")
+	assert.NotNil(t, err)
+	assert.Contains(t, output, image+" is not built")
+
+	lockFile, _ := dockerized.ReadLockFile(filepath.Join(dir, "dockerized.lock"))
+	labels := map[string]string{dockerized.LabelBuildHash: lockFile.Services["tool"].BuildHash}
+	images = map[string]moby.ImageInspect{image: {ID: "sha256:tool", Config: &container.Config{Labels: labels}}}
+	_, output, err, _ = runFake(t, dir, verifyConfig(dir, home, &fake.Backend{Images: images}), "verify", "tool")
+	assert.Nil(t, err)
+	assert.Regexp(t, `tool\s+ok\s+`+image+` \(build `, output)
+}
+
+func TestRunLabelsBuiltImage(t *testing.T) {
+	dir, home := newLockProject(t)
+	_, _, err, _ := runFake(t, dir, lockConfig(dir, home), "lock")
+	assert.Nil(t, err)
+	lockFile, _ := dockerized.ReadLockFile(filepath.Join(dir, "dockerized.lock"))
+
+	backend, _, err, _ := runFake(t, dir, lockConfig(dir, home), "tool")
+	assert.Nil(t, err)
+	assert.Equal(t, lockFile.Services["tool"].BuildHash, backend.LastRun().Service.Build.Labels[dockerized.LabelBuildHash])
+}
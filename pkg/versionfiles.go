@@ -0,0 +1,206 @@
+package dockerized
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// versionFile is a file in which other tools declare the version of a toolchain, e.g. .nvmrc.
+type versionFile struct {
+	Name string
+	// Parse returns the version variables declared in the content of the file, and their line numbers.
+	Parse func(content string) (variables map[string]string, lines map[string]int)
+}
+
+// versionFiles are read when DOCKERIZED_VERSION_FILES is enabled, in order of precedence, from low to high.
+var versionFiles = []versionFile{
+	{Name: ".tool-versions", Parse: parseToolVersions},
+	{Name: "go.mod", Parse: parseGoMod},
+	{Name: "rust-toolchain.toml", Parse: parseRustToolchain},
+	{Name: ".python-version", Parse: parseSingleVersion("PYTHON_VERSION")},
+	{Name: ".node-version", Parse: parseSingleVersion("NODE_VERSION")},
+	{Name: ".nvmrc", Parse: parseSingleVersion("NODE_VERSION")},
+}
+
+// toolVersionVariables maps the tools of asdf to the version variables of dockerized, where they differ from
+// <TOOL>_VERSION.
+var toolVersionVariables = map[string]string{
+	"golang": "GO_VERSION",
+	"nodejs": "NODE_VERSION",
+}
+
+// versionFileValuePattern matches versions, but not aliases, such as `lts/*`, `stable` or `system`.
+var versionFileValuePattern = regexp.MustCompile(`^v?(\d+(?:\.\d+){0,2})$`)
+var goModVersionPattern = regexp.MustCompile(`^go\s+(\S+)`)
+var goModToolchainPattern = regexp.MustCompile(`^toolchain\s+go(\S+)`)
+var rustToolchainChannelPattern = regexp.MustCompile(`^\s*channel\s*=\s*["']([^"']*)["']`)
+var versionAliasPattern = regexp.MustCompile(`^\s*([A-Z0-9_]+_VERSION)\s*=\s*["']?\$\{([A-Z0-9_]+_VERSION)\}["']?\s*$`)
+var toolVersionVariablePattern = regexp.MustCompile(`^[A-Z0-9_]+_VERSION$`)
+
+// isVersionFile returns whether path is one of the versionFiles.
+func isVersionFile(path string) bool {
+	for _, file := range versionFiles {
+		if filepath.Base(path) == file.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// findVersionFilesRoot returns the directory to read the version files from: the project root, or else the nearest
+// directory with a version file.
+func findVersionFilesRoot(env *Environment, hostCwd string) string {
+	if projectRoot := env.Get("DOCKERIZED_PROJECT_ROOT"); projectRoot != "" {
+		return projectRoot
+	}
+	path := hostCwd
+	for i := 0; i < 10; i++ {
+		for _, file := range versionFiles {
+			if _, err := os.Stat(filepath.Join(path, file.Name)); err == nil {
+				return path
+			}
+		}
+		path = filepath.Dir(path)
+	}
+	return ""
+}
+
+// readVersionFiles reads the version files in dir. Each file that declares a version is returned as a layer.
+// Variables that are derived from a version in the default .env file are set as well, e.g. RUSTC_VERSION for
+// `RUSTC_VERSION=${RUST_VERSION}`.
+func readVersionFiles(dir string, defaultEnvFile string) ([]EnvFile, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	aliases, err := readVersionAliases(defaultEnvFile)
+	if err != nil {
+		return nil, err
+	}
+	var envFiles []EnvFile
+	for _, file := range versionFiles {
+		path := filepath.Join(dir, file.Name)
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		variables, lines := file.Parse(string(content))
+		if len(variables) == 0 {
+			continue
+		}
+		for alias, variable := range aliases {
+			if value, ok := variables[variable]; ok {
+				variables[alias], lines[alias] = value, lines[variable]
+			}
+		}
+		envFiles = append(envFiles, EnvFile{Path: path, Variables: variables, Lines: lines})
+	}
+	return envFiles, nil
+}
+
+// readVersionAliases returns the variables of the .env file that are set to another version variable, e.g.
+// `RUSTC_VERSION=${RUST_VERSION}`, by the alias.
+func readVersionAliases(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	aliases := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if match := versionAliasPattern.FindStringSubmatch(line); match != nil {
+			aliases[match[1]] = match[2]
+		}
+	}
+	return aliases, nil
+}
+
+// versionFileValue returns the version in value, without a leading `v`.
+func versionFileValue(value string) (string, bool) {
+	match := versionFileValuePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// parseSingleVersion parses files that only contain a version, such as .nvmrc.
+func parseSingleVersion(variable string) func(content string) (map[string]string, map[string]int) {
+	return func(content string) (map[string]string, map[string]int) {
+		for index, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if value, ok := versionFileValue(line); ok {
+				return map[string]string{variable: value}, map[string]int{variable: index + 1}
+			}
+			return nil, nil
+		}
+		return nil, nil
+	}
+}
+
+// parseToolVersions parses .tool-versions of asdf, e.g. `nodejs 18.2.0`. If a tool has multiple versions, the first
+// is used.
+func parseToolVersions(content string) (map[string]string, map[string]int) {
+	variables, lines := map[string]string{}, map[string]int{}
+	for index, line := range strings.Split(content, "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		variable, ok := toolVersionVariables[fields[0]]
+		if !ok {
+			variable = strings.ToUpper(strings.ReplaceAll(fields[0], "-", "_")) + "_VERSION"
+		}
+		value, ok := versionFileValue(fields[1])
+		if !ok || !toolVersionVariablePattern.MatchString(variable) {
+			continue
+		}
+		variables[variable] = value
+		lines[variable] = index + 1
+	}
+	return variables, lines
+}
+
+// parseGoMod parses the `go` directive of go.mod, or the `toolchain` directive, which takes precedence.
+func parseGoMod(content string) (map[string]string, map[string]int) {
+	variables, lines := map[string]string{}, map[string]int{}
+	for index, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if match := goModToolchainPattern.FindStringSubmatch(line); match != nil {
+			if value, ok := versionFileValue(match[1]); ok {
+				variables["GO_VERSION"], lines["GO_VERSION"] = value, index+1
+				break
+			}
+		}
+		if match := goModVersionPattern.FindStringSubmatch(line); match != nil {
+			if value, ok := versionFileValue(match[1]); ok {
+				variables["GO_VERSION"], lines["GO_VERSION"] = value, index+1
+			}
+		}
+	}
+	return variables, lines
+}
+
+// parseRustToolchain parses the channel of rust-toolchain.toml, if it is a version.
+func parseRustToolchain(content string) (map[string]string, map[string]int) {
+	for index, line := range strings.Split(content, "\n") {
+		if match := rustToolchainChannelPattern.FindStringSubmatch(line); match != nil {
+			if value, ok := versionFileValue(match[1]); ok {
+				return map[string]string{"RUST_VERSION": value}, map[string]int{"RUST_VERSION": index + 1}
+			}
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package dockerized_test
+
+import (
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newVersionFilesProject writes a project that declares the versions of tools in their own files.
+func newVersionFilesProject(t *testing.T, envFile string) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dockerized.env":      envFile,
+		".nvmrc":              "v18.2.0\n",
+		"go.mod":              "module example.com/app\n\ngo 1.18\n",
+		".tool-versions":      "# asdf\nnodejs 16.15.0\npython 3.9.1 3.8.13\nrust 1.60.0\nterraform 1.2.0\n",
+		"rust-toolchain.toml": "[toolchain]\nchannel = \"1.61.0\"\ncomponents = [\"rustfmt\"]\n",
+		".python-version":     "system\n",
+	}
+	for name, content := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestRunVersionFiles(t *testing.T) {
+	t.Parallel()
+	dir := newVersionFilesProject(t, "DOCKERIZED_VERSION_FILES=true\n")
+	for command, image := range map[string]string{
+		"node":   "node:18.2.0",
+		"go":     "golang:1.18",
+		"python": "python:3.9.1",
+		// RUSTC_VERSION=${RUST_VERSION} in the default .env follows rust-toolchain.toml.
+		"rustc": "rust:1.61.0",
+	} {
+		backend, _, err, _ := runFake(t, dir, dockerized.Config{}, command)
+		assert.Nil(t, err, command)
+		assert.Equal(t, image, backend.LastRun().Service.Image, command)
+	}
+}
+
+func TestRunVersionFilesAreOptIn(t *testing.T) {
+	t.Parallel()
+	dir := newVersionFilesProject(t, "")
+	backend, _, err, _ := runFake(t, dir, dockerized.Config{}, "node")
+	assert.Nil(t, err)
+	assert.Equal(t, "node:17.7.2", backend.LastRun().Service.Image)
+
+	backend, _, err, _ = runFake(t, dir, dockerized.Config{Env: []string{"DOCKERIZED_VERSION_FILES=1"}}, "node")
+	assert.Nil(t, err)
+	assert.Equal(t, "node:18.2.0", backend.LastRun().Service.Image)
+}
+
+func TestRunProjectEnvFileOverridesVersionFiles(t *testing.T) {
+	t.Parallel()
+	dir := newVersionFilesProject(t, "DOCKERIZED_VERSION_FILES=true\nNODE_VERSION=16.14.0\nRUSTC_VERSION=1.58.0\n")
+	backend, _, err, _ := runFake(t, dir, dockerized.Config{}, "node")
+	assert.Nil(t, err)
+	assert.Equal(t, "node:16.14.0", backend.LastRun().Service.Image)
+
+	backend, _, err, _ = runFake(t, dir, dockerized.Config{}, "rustc")
+	assert.Nil(t, err)
+	assert.Equal(t, "rust:1.58.0", backend.LastRun().Service.Image)
+
+	backend, _, err, _ = runFake(t, dir, dockerized.Config{Env: []string{"NODE_VERSION=15.0.0"}}, "node")
+	assert.Nil(t, err)
+	assert.Equal(t, "node:15.0.0", backend.LastRun().Service.Image)
+}
+
+func TestRunVersionFilesVerbose(t *testing.T) {
+	t.Parallel()
+	dir := newVersionFilesProject(t, "DOCKERIZED_VERSION_FILES=true\n")
+	_, output, err, _ := runFake(t, dir, dockerized.Config{}, "--verbose", "node")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "Loading: '"+filepath.Join(dir, ".nvmrc")+"'\n  NODE_VERSION=18.2.0\n")
+	assert.Contains(t, output, "Loading: '"+filepath.Join(dir, ".tool-versions")+"'\n  NODE_VERSION=16.15.0\n  PYTHON_VERSION=3.9.1\n  RUSTC_VERSION=1.60.0\n  RUST_VERSION=1.60.0\n  TERRAFORM_VERSION=1.2.0\n")
+	assert.NotContains(t, output, filepath.Join(dir, ".python-version"))
+
+	_, output, err, _ = runFake(t, dir, dockerized.Config{}, "env", "--explain", "NODE_VERSION")
+	assert.Nil(t, err)
+	assert.Contains(t, output, filepath.Join(dir, ".nvmrc")+":1")
+}
@@ -0,0 +1,193 @@
+package dockerized
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/distribution/reference"
+	"github.com/hashicorp/go-version"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Names of the built-in version sources, for `x-dockerized.versions.source`.
+const (
+	VersionSourceDockerHub = "dockerhub"
+	VersionSourceRegistry  = "registry"
+	VersionSourceNpm       = "npm"
+	VersionSourcePyPI      = "pypi"
+	VersionSourceGitHub    = "github"
+	VersionSourceGoProxy   = "goproxy"
+)
+
+// VersionProvider lists the available versions of a command, as used by `dockerized <command>:?`.
+type VersionProvider interface {
+	// ListVersions returns the raw versions, such as image tags or release names, of the package in request.
+	ListVersions(ctx context.Context, request VersionRequest) ([]string, error)
+}
+
+// VersionRequest identifies the package to list the versions of.
+type VersionRequest struct {
+	Service types.ServiceConfig
+	// Name is the package in the source, e.g. an image, an npm package or a GitHub repository.
+	Name string
+	Env  *Environment
+}
+
+// VersionProviders are the available version sources, by name.
+type VersionProviders map[string]VersionProvider
+
+// DefaultVersionProviders returns the built-in version sources.
+func DefaultVersionProviders() VersionProviders {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	return VersionProviders{
+		VersionSourceDockerHub: &DockerHubVersionProvider{},
+		VersionSourceRegistry:  &RegistryVersionProvider{},
+		VersionSourceNpm:       &NpmVersionProvider{BaseUrl: "https://registry.npmjs.org", HttpClient: httpClient},
+		VersionSourcePyPI:      &PyPIVersionProvider{BaseUrl: "https://pypi.org", HttpClient: httpClient},
+		VersionSourceGitHub:    &GitHubVersionProvider{BaseUrl: "https://api.github.com", HttpClient: httpClient},
+		VersionSourceGoProxy:   &GoProxyVersionProvider{BaseUrl: "https://proxy.golang.org", HttpClient: httpClient},
+	}
+}
+
+// Register adds or replaces the version source with the given name.
+func (p VersionProviders) Register(name string, provider VersionProvider) {
+	p[name] = provider
+}
+
+// GetVersionSource determines where to find the versions of a service, and the name of the service's package there.
+//
+// The source can be configured with `x-dockerized.versions`. Otherwise, it's npm for services that run `npx`, PyPI
+// for services that install pip packages with apps/pip, and the registry of the image for other services.
+func GetVersionSource(service types.ServiceConfig) (source string, name string, err error) {
+	extension, err := GetServiceExtension(service)
+	if err != nil {
+		return "", "", err
+	}
+	source = extension.Versions.Source
+	name = extension.Versions.Name
+
+	if source == "" {
+		if npmPackage := getNpxPackage(service); npmPackage != "" {
+			return VersionSourceNpm, npmPackage, nil
+		}
+		if getPipPackage(service) != "" {
+			source = VersionSourcePyPI
+		} else if service.Build != nil {
+			return "", "", &BuildStepError{Command: service.Name}
+		} else {
+			source = VersionSourceRegistry
+			if ref, err := reference.ParseDockerRef(service.Image); err == nil && reference.Domain(ref) == "docker.io" {
+				source = VersionSourceDockerHub
+			}
+		}
+	}
+
+	if name == "" {
+		switch source {
+		case VersionSourceDockerHub, VersionSourceRegistry:
+			name = service.Image
+		case VersionSourceNpm:
+			name = getNpxPackage(service)
+		case VersionSourcePyPI:
+			name = getPipPackage(service)
+			if name == "" {
+				name = service.Name
+			}
+		}
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("cannot list versions for command %s: please set x-dockerized.versions.name for source %s", service.Name, source)
+	}
+	return source, name, nil
+}
+
+var npxPackagePattern = regexp.MustCompile(`--package=(@?[^@]+)@([^\s]+)`)
+
+// Returns the npm package of services with entrypoint `npx --package=<package>@<version>`, or "".
+func getNpxPackage(service types.ServiceConfig) string {
+	if len(service.Entrypoint) < 2 || service.Entrypoint[0] != "npx" {
+		return ""
+	}
+	match := npxPackagePattern.FindStringSubmatch(service.Entrypoint[1])
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// ListCommandVersions returns the raw versions of the command, from the version source of its service. The versions
+// are cached in cache, if not nil.
+func ListCommandVersions(ctx context.Context, providers VersionProviders, cache *VersionCache, project *types.Project, env *Environment, commandName string) ([]string, error) {
+	service, err := project.GetService(commandName)
+	if err != nil {
+		return nil, err
+	}
+	return listServiceVersions(ctx, providers, cache, service, env)
+}
+
+// listServiceVersions returns the sorted raw versions of the service, using cache if not nil.
+func listServiceVersions(ctx context.Context, providers VersionProviders, cache *VersionCache, service types.ServiceConfig, env *Environment) ([]string, error) {
+	source, name, err := GetVersionSource(service)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := providers[source]
+	if !ok {
+		return nil, &UnsupportedVersionSourceError{Command: service.Name, Source: source}
+	}
+
+	rawVersions, err := cache.ListVersions(ctx, source, provider, VersionRequest{
+		Service: service,
+		Name:    name,
+		Env:     env,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rawVersions = append([]string(nil), rawVersions...)
+	sort.Strings(rawVersions)
+	return unique(rawVersions), nil
+}
+
+func getSemanticVersions(rawVersions []string) ([]string, error) {
+	var semanticVersions []string
+	for _, rawVersion := range rawVersions {
+		var semanticVersion = regexp.MustCompile(`^v?(\d+(\.\d+)*$)`).FindStringSubmatch(rawVersion)
+		if semanticVersion != nil {
+			semanticVersions = append(semanticVersions, semanticVersion[1])
+		}
+	}
+	return semanticVersions, nil
+}
+
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		v1, e1 := version.NewVersion(versions[i])
+		v2, e2 := version.NewVersion(versions[j])
+		return e1 == nil && e2 == nil && v1.LessThan(v2)
+	})
+}
+
+// getJson requests url, and decodes the json response into target.
+func getJson(ctx context.Context, client *http.Client, url string, headers map[string]string, target interface{}) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("%s: %s", url, response.Status)
+	}
+	return response, json.NewDecoder(response.Body).Decode(target)
+}
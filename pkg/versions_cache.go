@@ -0,0 +1,182 @@
+package dockerized
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DefaultVersionCacheTTL is how long listed versions are used, before they are requested again.
+const DefaultVersionCacheTTL = time.Hour
+
+// DefaultVersionCacheFailureTTL is how long a failure to list versions is remembered, so commands don't wait for an
+// unreachable registry on every run.
+const DefaultVersionCacheFailureTTL = 5 * time.Minute
+
+// VersionCache stores the versions listed by version providers on disk, so they aren't requested on every run.
+// When versions can't be requested, e.g. without a network connection, expired versions are used with a warning.
+type VersionCache struct {
+	Dir string
+	TTL time.Duration
+	// FailureTTL is how long a failure to list versions is returned, before the versions are requested again.
+	FailureTTL time.Duration
+	// Refresh requests the versions, even if they are cached.
+	Refresh bool
+	// Offline never requests the versions, and uses cached versions regardless of their age.
+	Offline bool
+	// Warnings receives a warning when expired versions are used.
+	Warnings io.Writer
+}
+
+// NewVersionCache returns the cache in ~/.dockerized/cache/versions. The TTL can be set with
+// DOCKERIZED_VERSION_CACHE_TTL, e.g. `24h`, and offline mode with DOCKERIZED_OFFLINE.
+func NewVersionCache(env *Environment) (*VersionCache, error) {
+	cache := &VersionCache{
+		Dir:        filepath.Join(env.HomeDir(), ".dockerized", "cache", "versions"),
+		TTL:        DefaultVersionCacheTTL,
+		FailureTTL: DefaultVersionCacheFailureTTL,
+	}
+	if ttl := env.Get("DOCKERIZED_VERSION_CACHE_TTL"); ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOCKERIZED_VERSION_CACHE_TTL: %w", err)
+		}
+		cache.TTL = duration
+	}
+	cache.Offline, _ = strconv.ParseBool(env.Get("DOCKERIZED_OFFLINE"))
+	return cache, nil
+}
+
+type versionCacheEntry struct {
+	Source   string    `json:"source"`
+	Name     string    `json:"name"`
+	Time     time.Time `json:"time"`
+	Versions []string  `json:"versions"`
+	// Error is the last failure to list the versions, at FailureTime. The versions of an earlier success are kept.
+	Error       string    `json:"error,omitempty"`
+	FailureTime time.Time `json:"failure_time,omitempty"`
+}
+
+// ListVersions returns the cached versions of the package in request, if they haven't expired. Otherwise, they are
+// listed by provider, and stored in the cache. A nil cache lists the versions directly.
+func (c *VersionCache) ListVersions(ctx context.Context, source string, provider VersionProvider, request VersionRequest) ([]string, error) {
+	if c == nil {
+		return provider.ListVersions(ctx, request)
+	}
+
+	key := versionCacheKey(source, request.Name)
+	path := c.path(source, key)
+	entry, err := readVersionCacheEntry(path)
+	cached := err == nil && !entry.Time.IsZero()
+	if cached && !c.Refresh && time.Since(entry.Time) < c.TTL {
+		return entry.Versions, nil
+	}
+
+	if c.Offline {
+		if !cached {
+			return nil, fmt.Errorf("cannot list versions of %s in offline mode, because they are not cached", key)
+		}
+		c.warn("Offline: using versions of %s from %s.\n", key, entry.Time.Format(time.RFC1123))
+		return entry.Versions, nil
+	}
+
+	failedRecently := err == nil && entry.Error != "" && time.Since(entry.FailureTime) < c.FailureTTL
+	if failedRecently && !c.Refresh {
+		if !cached {
+			return nil, fmt.Errorf("cannot list versions of %s: %s (at %s, use --refresh to retry)", key, entry.Error, entry.FailureTime.Format(time.RFC1123))
+		}
+		return entry.Versions, nil
+	}
+
+	versions, err := provider.ListVersions(ctx, request)
+	if err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// Interrupted, e.g. with Ctrl+C, so the next run tries again.
+		return nil, err
+	}
+	if err != nil {
+		entry.Source = source
+		entry.Name = key
+		entry.Error = err.Error()
+		entry.FailureTime = time.Now()
+		_ = writeVersionCacheEntry(path, entry)
+		if !cached {
+			return nil, err
+		}
+		c.warn("Cannot list versions of %s: %s\nUsing versions from %s.\n", key, err, entry.Time.Format(time.RFC1123))
+		return entry.Versions, nil
+	}
+	// The cache is an optimization, so failing to write it is not an error.
+	_ = writeVersionCacheEntry(path, versionCacheEntry{
+		Source:   source,
+		Name:     key,
+		Time:     time.Now(),
+		Versions: versions,
+	})
+	return versions, nil
+}
+
+func (c *VersionCache) warn(format string, args ...interface{}) {
+	if c.Warnings != nil {
+		fmt.Fprintf(c.Warnings, format, args...)
+	}
+}
+
+func (c *VersionCache) path(source string, key string) string {
+	hash := sha256.Sum256([]byte(source + "\x00" + key))
+	return filepath.Join(c.Dir, source+"-"+hex.EncodeToString(hash[:8])+".json")
+}
+
+// versionCacheKey returns the name of the package without its version. Images are cached by repository, regardless of
+// their tag.
+func versionCacheKey(source string, name string) string {
+	if source == VersionSourceDockerHub || source == VersionSourceRegistry {
+		if ref, err := reference.ParseNormalizedNamed(name); err == nil {
+			return reference.TrimNamed(ref).String()
+		}
+	}
+	return name
+}
+
+func readVersionCacheEntry(path string) (versionCacheEntry, error) {
+	var entry versionCacheEntry
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(content, &entry)
+	return entry, err
+}
+
+func writeVersionCacheEntry(path string, entry versionCacheEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so concurrent runs never read a partial entry.
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(content)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
@@ -0,0 +1,158 @@
+package dockerized_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestVersionCache(t *testing.T) (*dockerized.VersionCache, *bytes.Buffer) {
+	var warnings bytes.Buffer
+	return &dockerized.VersionCache{Dir: t.TempDir(), TTL: time.Hour, Warnings: &warnings}, &warnings
+}
+
+func TestVersionCache(t *testing.T) {
+	cache, warnings := newTestVersionCache(t)
+	provider := &countingVersionProvider{versions: []string{"1.0.0"}}
+	request := dockerized.VersionRequest{Name: "node:16"}
+
+	for i := 0; i < 2; i++ {
+		versions, err := cache.ListVersions(context.Background(), dockerized.VersionSourceDockerHub, provider, request)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1.0.0"}, versions)
+	}
+	// Images are cached by repository.
+	_, err := cache.ListVersions(context.Background(), dockerized.VersionSourceDockerHub, provider, dockerized.VersionRequest{Name: "node:17"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), provider.calls)
+
+	cache.Refresh = true
+	_, err = cache.ListVersions(context.Background(), dockerized.VersionSourceDockerHub, provider, request)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), provider.calls)
+	assert.Empty(t, warnings.String())
+}
+
+func TestVersionCacheExpires(t *testing.T) {
+	cache, _ := newTestVersionCache(t)
+	cache.TTL = time.Nanosecond
+	provider := &countingVersionProvider{versions: []string{"1.0.0"}}
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, provider, dockerized.VersionRequest{Name: "typescript"})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(2), provider.calls)
+}
+
+func TestVersionCacheUsesExpiredVersionsOnError(t *testing.T) {
+	cache, warnings := newTestVersionCache(t)
+	cache.TTL = time.Nanosecond
+	request := dockerized.VersionRequest{Name: "typescript"}
+	_, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, &countingVersionProvider{versions: []string{"1.0.0"}}, request)
+	assert.Nil(t, err)
+
+	versions, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, &countingVersionProvider{err: errors.New("no network")}, request)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.0.0"}, versions)
+	assert.Contains(t, warnings.String(), "Cannot list versions of typescript: no network\n")
+
+	_, err = cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, &countingVersionProvider{err: errors.New("no network")}, dockerized.VersionRequest{Name: "vue"})
+	assert.EqualError(t, err, "no network")
+}
+
+func TestVersionCacheOffline(t *testing.T) {
+	cache, warnings := newTestVersionCache(t)
+	cache.TTL = time.Nanosecond
+	request := dockerized.VersionRequest{Name: "typescript"}
+	_, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, &countingVersionProvider{versions: []string{"1.0.0"}}, request)
+	assert.Nil(t, err)
+
+	cache.Offline = true
+	provider := &countingVersionProvider{versions: []string{"2.0.0"}}
+	versions, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, provider, request)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.0.0"}, versions)
+	assert.Contains(t, warnings.String(), "Offline: using versions of typescript from ")
+
+	_, err = cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, provider, dockerized.VersionRequest{Name: "vue"})
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(0), provider.calls)
+}
+
+func TestRunListVersionsRefresh(t *testing.T) {
+	provider := &countingVersionProvider{versions: appVersions}
+	home := t.TempDir()
+	for _, args := range [][]string{{"app:?"}, {"app:?"}, {"--refresh", "app:?"}} {
+		_, output, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider, "HOME="+home), args...)
+		assert.Nil(t, err)
+		assert.Contains(t, output, "1.2.0, 1.2.3\n")
+	}
+	assert.Equal(t, int32(2), provider.calls)
+
+	_, _, err, _ := runFake(t, t.TempDir(), newResolveConfig(t, provider), "--offline", "app:?")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), provider.calls)
+}
+
+func TestVersionCacheRemembersFailure(t *testing.T) {
+	cache, _ := newTestVersionCache(t)
+	cache.FailureTTL = time.Hour
+	failing := &countingVersionProvider{err: errors.New("no network")}
+	request := dockerized.VersionRequest{Name: "vue"}
+
+	_, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, failing, request)
+	assert.EqualError(t, err, "no network")
+	_, err = cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, failing, request)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot list versions of vue: no network")
+	assert.Contains(t, err.Error(), "use --refresh to retry")
+	assert.Equal(t, int32(1), failing.calls)
+
+	cache.Refresh = true
+	versions, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, &countingVersionProvider{versions: []string{"3.0.0"}}, request)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3.0.0"}, versions)
+}
+
+func TestVersionCacheForgetsCancellation(t *testing.T) {
+	cache, _ := newTestVersionCache(t)
+	cache.FailureTTL = time.Hour
+	request := dockerized.VersionRequest{Name: "vue"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cache.ListVersions(ctx, dockerized.VersionSourceNpm, &countingVersionProvider{err: ctx.Err()}, request)
+	assert.ErrorIs(t, err, context.Canceled)
+	files, _ := os.ReadDir(cache.Dir)
+	assert.Empty(t, files)
+
+	provider := &countingVersionProvider{versions: []string{"3.0.0"}}
+	versions, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, provider, request)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3.0.0"}, versions)
+	assert.Equal(t, int32(1), provider.calls)
+}
+
+func TestVersionCacheRemembersFailureWithExpiredVersions(t *testing.T) {
+	cache, warnings := newTestVersionCache(t)
+	cache.TTL = time.Nanosecond
+	cache.FailureTTL = time.Hour
+	request := dockerized.VersionRequest{Name: "typescript"}
+	_, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, &countingVersionProvider{versions: []string{"1.0.0"}}, request)
+	assert.Nil(t, err)
+
+	failing := &countingVersionProvider{err: errors.New("no network")}
+	for i := 0; i < 2; i++ {
+		versions, err := cache.ListVersions(context.Background(), dockerized.VersionSourceNpm, failing, request)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1.0.0"}, versions)
+	}
+	assert.Equal(t, int32(1), failing.calls)
+	assert.Contains(t, warnings.String(), "Cannot list versions of typescript: no network\n")
+}
@@ -0,0 +1,60 @@
+package dockerized
+
+import (
+	"context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/hub-tool/pkg/hub"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// versionListTimeout limits how long listing the tags of an image may take, including all pages.
+const versionListTimeout = time.Minute
+
+// DockerHubVersionProvider lists the tags of an image on Docker Hub.
+type DockerHubVersionProvider struct{}
+
+func (p *DockerHubVersionProvider) ListVersions(ctx context.Context, request VersionRequest) ([]string, error) {
+	ref, err := reference.ParseDockerRef(request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, versionListTimeout)
+	defer cancel()
+	hubClient, err := hub.NewClient(
+		hub.WithAllElements(),
+		hub.WithContext(ctx),
+		hub.WithHTTPClient(&http.Client{Timeout: 30 * time.Second}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tags, _, err := hubClient.GetTags(reference.Path(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, tag := range tags {
+		var tagParts = strings.Split(tag.Name, ":")
+		versions = append(versions, tagParts[len(tagParts)-1])
+	}
+	return versions, nil
+}
+
+// RegistryVersionProvider lists the tags of an image in a registry that implements the Registry v2 API.
+// The credentials of `docker login` are used for private registries.
+type RegistryVersionProvider struct{}
+
+func (p *RegistryVersionProvider) ListVersions(ctx context.Context, request VersionRequest) ([]string, error) {
+	ref, err := reference.ParseDockerRef(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, versionListTimeout)
+	defer cancel()
+	registryClient := NewRegistryClient(DockerCredentials(request.Env))
+	return registryClient.ListTags(ctx, registryHost(ref), reference.Path(ref))
+}
@@ -0,0 +1,69 @@
+package dockerized
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitHubVersionProvider lists the releases of a GitHub repository, for commands that are installed from GitHub
+// releases by a build script. The name of the request is the repository, e.g. `cli/cli`.
+//
+// Requests are authenticated with GH_TOKEN or GITHUB_TOKEN, if set, to avoid the rate limit of anonymous requests.
+// GITHUB_API_URL overrides BaseUrl, e.g. for GitHub Enterprise Server.
+type GitHubVersionProvider struct {
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+func (p *GitHubVersionProvider) ListVersions(ctx context.Context, request VersionRequest) ([]string, error) {
+	baseUrl := p.BaseUrl
+	headers := map[string]string{
+		"Accept": "application/vnd.github.v3+json",
+	}
+	if request.Env != nil {
+		if apiUrl := request.Env.Get("GITHUB_API_URL"); apiUrl != "" {
+			baseUrl = apiUrl
+		}
+		if token := gitHubToken(request.Env); token != "" {
+			headers["Authorization"] = "Bearer " + token
+		}
+	}
+
+	pageUrl, err := url.Parse(strings.TrimSuffix(baseUrl, "/") + "/repos/" + request.Name + "/releases?per_page=100")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for pageUrl != nil {
+		var releases []struct {
+			TagName    string `json:"tag_name"`
+			Draft      bool   `json:"draft"`
+			Prerelease bool   `json:"prerelease"`
+		}
+		response, err := getJson(ctx, p.HttpClient, pageUrl.String(), headers, &releases)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			if !release.Draft && !release.Prerelease {
+				versions = append(versions, release.TagName)
+			}
+		}
+		pageUrl, err = nextPageUrl(pageUrl, response.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// gitHubToken returns the token for the GitHub API, using the same variables as the GitHub CLI.
+func gitHubToken(env *Environment) string {
+	if token := env.Get("GH_TOKEN"); token != "" {
+		return token
+	}
+	return env.Get("GITHUB_TOKEN")
+}
@@ -0,0 +1,69 @@
+package dockerized
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// GoProxyVersionProvider lists the versions of a Go module from a Go module proxy. The proxy is taken from GOPROXY,
+// if set. The name of the request is the module path, e.g. `golang.org/x/tools`.
+type GoProxyVersionProvider struct {
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+func (p *GoProxyVersionProvider) ListVersions(ctx context.Context, request VersionRequest) ([]string, error) {
+	baseUrl := p.BaseUrl
+	if request.Env != nil {
+		if proxy := goProxyUrl(request.Env.Get("GOPROXY")); proxy != "" {
+			baseUrl = proxy
+		}
+	}
+
+	listUrl := strings.TrimSuffix(baseUrl, "/") + "/" + escapeModulePath(request.Name) + "/@v/list"
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, listUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.HttpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", listUrl, response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(body)), nil
+}
+
+// Returns the first proxy url in GOPROXY, e.g. `https://goproxy.io,direct`, or "" if there is none.
+func goProxyUrl(goproxy string) string {
+	for _, proxy := range strings.FieldsFunc(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if strings.HasPrefix(proxy, "https://") || strings.HasPrefix(proxy, "http://") {
+			return proxy
+		}
+	}
+	return ""
+}
+
+// Escapes upper case letters in a module path, as required by the module proxy protocol: `Azure` becomes `!azure`.
+func escapeModulePath(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			escaped.WriteRune('!')
+			escaped.WriteRune(unicode.ToLower(r))
+		} else {
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
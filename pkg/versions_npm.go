@@ -0,0 +1,30 @@
+package dockerized
+
+import (
+	"context"
+	"net/http"
+)
+
+// NpmVersionProvider lists the versions of a package in the npm registry.
+type NpmVersionProvider struct {
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+func (p *NpmVersionProvider) ListVersions(ctx context.Context, request VersionRequest) ([]string, error) {
+	var registryResponse struct {
+		Versions map[string]interface{} `json:"versions"`
+	}
+	_, err := getJson(ctx, p.HttpClient, p.BaseUrl+"/"+request.Name, map[string]string{
+		"Accept": "application/vnd.npm.install-v1+json",
+	}, &registryResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for version := range registryResponse.Versions {
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
@@ -0,0 +1,193 @@
+package dockerized
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+)
+
+// Output formats of `dockerized <command>:?`, for --output.
+const (
+	OutputPlain = "plain"
+	OutputJson  = "json"
+	OutputYaml  = "yaml"
+)
+
+// VersionListing describes the available versions of a command, as listed by `dockerized <command>:?`.
+type VersionListing struct {
+	Command string `json:"command" yaml:"command"`
+	// Current is the version the command is currently configured to use, if it has a version variable.
+	Current *ConfiguredVersion `json:"current,omitempty" yaml:"current,omitempty"`
+	// Latest is the highest semantic version.
+	Latest string `json:"latest" yaml:"latest"`
+	// Versions are the semantic versions, from low to high.
+	Versions []string `json:"versions" yaml:"versions"`
+	// Groups are the Versions, grouped by minor version.
+	Groups []VersionGroup `json:"groups" yaml:"groups"`
+	// RawVersions are the versions as found in the version source, e.g. image tags.
+	RawVersions []string `json:"raw_versions" yaml:"raw_versions"`
+}
+
+// VersionGroup contains the versions with the same minor version, e.g. 1.17.
+type VersionGroup struct {
+	Minor    string   `json:"minor" yaml:"minor"`
+	Versions []string `json:"versions" yaml:"versions"`
+}
+
+// ConfiguredVersion is the value of the version variable of a command, and where it is set.
+type ConfiguredVersion struct {
+	Variable string `json:"variable" yaml:"variable"`
+	Version  string `json:"version" yaml:"version"`
+	// Source is the .env file that sets the version, LayerEnvironment or LayerDockerized.
+	Source string `json:"source" yaml:"source"`
+	Line   int    `json:"line,omitempty" yaml:"line,omitempty"`
+}
+
+// NewVersionListing parses the semantic versions within rawVersions. Returns a NoVersionsError if there are none.
+func NewVersionListing(commandName string, rawVersions []string) (*VersionListing, error) {
+	semanticVersions, err := getSemanticVersions(rawVersions)
+	if err != nil {
+		return nil, err
+	}
+	sortVersions(semanticVersions)
+	semanticVersions = unique(semanticVersions)
+
+	if len(semanticVersions) == 0 {
+		return nil, &NoVersionsError{Command: commandName, RawVersions: rawVersions}
+	}
+
+	groups, err := groupVersions(semanticVersions)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionListing{
+		Command:     commandName,
+		Latest:      semanticVersions[len(semanticVersions)-1],
+		Versions:    semanticVersions,
+		Groups:      groups,
+		RawVersions: rawVersions,
+	}, nil
+}
+
+// Limit keeps only the highest n semantic versions.
+func (l *VersionListing) Limit(n int) error {
+	if n <= 0 || n >= len(l.Versions) {
+		return nil
+	}
+	l.Versions = l.Versions[len(l.Versions)-n:]
+	groups, err := groupVersions(l.Versions)
+	if err != nil {
+		return err
+	}
+	l.Groups = groups
+	return nil
+}
+
+// groupVersions groups sorted versions by minor version.
+func groupVersions(versions []string) ([]VersionGroup, error) {
+	var groups []VersionGroup
+	for _, semanticVersion := range versions {
+		v, err := version.NewVersion(semanticVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		var minor string
+		var segments = v.Segments()
+		if len(segments) >= 2 {
+			minor = fmt.Sprintf("%d.%d", segments[0], segments[1])
+		} else {
+			minor = fmt.Sprintf("%d.0", segments[0])
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Minor != minor {
+			groups = append(groups, VersionGroup{Minor: minor})
+		}
+		group := &groups[len(groups)-1]
+		group.Versions = append(group.Versions, semanticVersion)
+	}
+	return groups, nil
+}
+
+// GetConfiguredVersion returns the current value of the version variable of the command, and where it is set.
+// Returns nil if the command has no version variable, or if it's not set.
+func GetConfiguredVersion(composeFilePaths []string, environ []string, envFiles []EnvFile, env *Environment, commandName string) (*ConfiguredVersion, error) {
+	rawProject, err := getRawProject(composeFilePaths)
+	if err != nil {
+		return nil, err
+	}
+	rawService, err := rawProject.GetService(commandName)
+	if err != nil {
+		return nil, err
+	}
+	variable, err := getVersionVariable(rawService)
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, explanation := range ExplainEnvironment(environ, envFiles, env, rawProject) {
+		if explanation.Name == variable && explanation.IsSet {
+			return &ConfiguredVersion{
+				Variable: variable,
+				Version:  explanation.Value,
+				Source:   explanation.Source.Layer,
+				Line:     explanation.Source.Line,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// IsOutputFormat returns whether format is supported by PrintVersionListing.
+func IsOutputFormat(format string) bool {
+	switch format {
+	case OutputPlain, OutputJson, OutputYaml:
+		return true
+	}
+	return false
+}
+
+// PrintVersionListing prints the listing in the given output format. The plain format prints a line per minor
+// version, and with verbose, the raw versions and the configured version.
+func PrintVersionListing(out io.Writer, listing *VersionListing, format string, verbose bool) error {
+	switch format {
+	case OutputJson:
+		content, err := json.MarshalIndent(listing, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", content)
+		return err
+	case OutputYaml:
+		content, err := yaml.Marshal(listing)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(content)
+		return err
+	case OutputPlain, "":
+		break
+	default:
+		return &UsageError{Message: fmt.Sprintf("unsupported output format: %s", format)}
+	}
+
+	if verbose {
+		fmt.Fprintf(out, "\n")
+		fmt.Fprintf(out, "Raw versions:\n")
+		for _, rawVersion := range listing.RawVersions {
+			fmt.Fprintf(out, "%s\n", rawVersion)
+		}
+		fmt.Fprintf(out, "\n")
+		if listing.Current != nil {
+			fmt.Fprintf(out, "Current: %s=%s (%s)\n", listing.Current.Variable, listing.Current.Version, VariableSource{Layer: listing.Current.Source, Line: listing.Current.Line})
+			fmt.Fprintf(out, "\n")
+		}
+	}
+
+	for _, group := range listing.Groups {
+		fmt.Fprintf(out, "%s\n", strings.Join(group.Versions, ", "))
+	}
+	return nil
+}
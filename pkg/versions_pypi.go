@@ -0,0 +1,80 @@
+package dockerized
+
+import (
+	"context"
+	"github.com/compose-spec/compose-go/types"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PyPIVersionProvider lists the releases of a Python package on PyPI. Yanked releases and pre-releases are skipped.
+type PyPIVersionProvider struct {
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+type pypiFile struct {
+	Yanked bool `json:"yanked"`
+}
+
+func (p *PyPIVersionProvider) ListVersions(ctx context.Context, request VersionRequest) ([]string, error) {
+	var pypiResponse struct {
+		Releases map[string][]pypiFile `json:"releases"`
+	}
+	_, err := getJson(ctx, p.HttpClient, p.BaseUrl+"/pypi/"+url.PathEscape(request.Name)+"/json", nil, &pypiResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for version, files := range pypiResponse.Releases {
+		if isPythonPrerelease(version) || isYanked(files) {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// A release is yanked when all of its files are yanked. Releases without files can't be installed either.
+func isYanked(files []pypiFile) bool {
+	for _, file := range files {
+		if !file.Yanked {
+			return false
+		}
+	}
+	return true
+}
+
+var pythonPrereleasePattern = regexp.MustCompile(`(?i)(a|b|c|rc|alpha|beta|pre|preview|dev)\d*`)
+
+// Returns whether version is a pre-release or development release, according to PEP 440. e.g. 1.0a1, 1.0rc2, 1.0.dev3
+func isPythonPrerelease(version string) bool {
+	return pythonPrereleasePattern.MatchString(version)
+}
+
+var pipPackageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+
+// getPipPackage returns the first package in the PIP_PACKAGES build argument of the service, as used by apps/pip, or
+// "" if there is none. e.g. `mkdocs==1.2.3 mkdocs-material` returns `mkdocs`.
+func getPipPackage(service types.ServiceConfig) string {
+	if service.Build == nil {
+		return ""
+	}
+	pipPackages, ok := service.Build.Args["PIP_PACKAGES"]
+	if !ok || pipPackages == nil {
+		return ""
+	}
+	for _, requirement := range strings.Fields(*pipPackages) {
+		if strings.HasPrefix(requirement, "-") {
+			// pip option, e.g. --upgrade
+			continue
+		}
+		if name := pipPackageNamePattern.FindString(requirement); name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,308 @@
+package dockerized_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/compose-spec/compose-go/types"
+	dockerized "github.com/datastack-net/dockerized/pkg"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetVersionSource(t *testing.T) {
+	tests := []struct {
+		service types.ServiceConfig
+		source  string
+		name    string
+	}{
+		{
+			service: types.ServiceConfig{Name: "go", Image: "golang:1.17.8"},
+			source:  dockerized.VersionSourceDockerHub,
+			name:    "golang:1.17.8",
+		},
+		{
+			service: types.ServiceConfig{Name: "dotnet", Image: "mcr.microsoft.com/dotnet/sdk:6.0-alpine"},
+			source:  dockerized.VersionSourceRegistry,
+			name:    "mcr.microsoft.com/dotnet/sdk:6.0-alpine",
+		},
+		{
+			service: types.ServiceConfig{Name: "tsc", Image: "node:17", Entrypoint: []string{"npx", "--package=typescript@4.6.2", "tsc"}},
+			source:  dockerized.VersionSourceNpm,
+			name:    "typescript",
+		},
+		{
+			service: types.ServiceConfig{
+				Name:       "gh",
+				Image:      "gh:2.5.2",
+				Build:      &types.BuildConfig{Context: "."},
+				Extensions: map[string]interface{}{"x-dockerized": map[string]interface{}{"versions": map[string]interface{}{"source": "github", "name": "cli/cli"}}},
+			},
+			source: dockerized.VersionSourceGitHub,
+			name:   "cli/cli",
+		},
+		{
+			service: types.ServiceConfig{
+				Name:       "mkdocs",
+				Build:      &types.BuildConfig{Context: "."},
+				Extensions: map[string]interface{}{"x-dockerized": map[string]interface{}{"versions": map[string]interface{}{"source": "pypi"}}},
+			},
+			source: dockerized.VersionSourcePyPI,
+			name:   "mkdocs",
+		},
+		{
+			service: types.ServiceConfig{
+				Name:  "mkdocs",
+				Build: &types.BuildConfig{Context: ".", Args: types.NewMappingWithEquals([]string{"PIP_PACKAGES=mkdocs[i18n]>=1.2 mkdocs-material"})},
+			},
+			source: dockerized.VersionSourcePyPI,
+			name:   "mkdocs",
+		},
+		{
+			service: types.ServiceConfig{
+				Name:       "mkdocs",
+				Build:      &types.BuildConfig{Context: ".", Args: types.NewMappingWithEquals([]string{"PIP_PACKAGES=--upgrade mkdocs-material"})},
+				Extensions: map[string]interface{}{"x-dockerized": map[string]interface{}{"versions": map[string]interface{}{"name": "mkdocs"}}},
+			},
+			source: dockerized.VersionSourcePyPI,
+			name:   "mkdocs",
+		},
+	}
+	for _, test := range tests {
+		source, name, err := dockerized.GetVersionSource(test.service)
+		assert.Nil(t, err, test.service.Name)
+		assert.Equal(t, test.source, source, test.service.Name)
+		assert.Equal(t, test.name, name, test.service.Name)
+	}
+}
+
+func TestGetVersionSourceBuildStep(t *testing.T) {
+	_, _, err := dockerized.GetVersionSource(types.ServiceConfig{Name: "zip", Build: &types.BuildConfig{Context: "."}})
+	assert.IsType(t, &dockerized.BuildStepError{}, err)
+}
+
+func TestNpmVersionProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/typescript", r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"name": "typescript", "versions": {"4.6.2": {}, "4.6.3": {}}}`)
+	}))
+	defer server.Close()
+
+	provider := &dockerized.NpmVersionProvider{BaseUrl: server.URL, HttpClient: server.Client()}
+	versions, err := provider.ListVersions(context.Background(), dockerized.VersionRequest{Name: "typescript"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"4.6.2", "4.6.3"}, versions)
+}
+
+func TestPyPIVersionProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/pypi/mkdocs/json", r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"info": {"name": "mkdocs"}, "releases": {"1.2.3": [{}], "1.3.0": [{}]}}`)
+	}))
+	defer server.Close()
+
+	provider := &dockerized.PyPIVersionProvider{BaseUrl: server.URL, HttpClient: server.Client()}
+	versions, err := provider.ListVersions(context.Background(), dockerized.VersionRequest{Name: "mkdocs"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1.2.3", "1.3.0"}, versions)
+}
+
+func TestPyPIVersionProviderSkipsYankedAndPrereleases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"releases": {
+			"1.2.3": [{"yanked": false}],
+			"1.2.4": [{"yanked": true}],
+			"1.2.5": [{"yanked": true}, {"yanked": false}],
+			"1.2.6": [],
+			"1.3.0a1": [{}],
+			"1.3.0b2": [{}],
+			"1.3.0rc1": [{}],
+			"1.3.0.dev1": [{}],
+			"1.3.0": [{}]
+		}}`)
+	}))
+	defer server.Close()
+
+	provider := &dockerized.PyPIVersionProvider{BaseUrl: server.URL, HttpClient: server.Client()}
+	versions, err := provider.ListVersions(context.Background(), dockerized.VersionRequest{Name: "mkdocs"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1.2.3", "1.2.5", "1.3.0"}, versions)
+}
+
+func TestGitHubVersionProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/cli/cli/releases", r.URL.Path)
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = fmt.Fprint(w, `[{"tag_name": "v2.4.0"}]`)
+			return
+		}
+		w.Header().Set("Link", `</repos/cli/cli/releases?per_page=100&page=2>; rel="next", </repos/cli/cli/releases?per_page=100&page=2>; rel="last"`)
+		_, _ = fmt.Fprint(w, `[{"tag_name": "v2.6.0-rc.1", "prerelease": true}, {"tag_name": "v2.5.2"}, {"tag_name": "v2.5.3", "draft": true}]`)
+	}))
+	defer server.Close()
+
+	provider := &dockerized.GitHubVersionProvider{BaseUrl: server.URL, HttpClient: server.Client()}
+	versions, err := provider.ListVersions(context.Background(), dockerized.VersionRequest{Name: "cli/cli"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v2.5.2", "v2.4.0"}, versions)
+}
+
+func TestGitHubVersionProviderUsesTokenAndApiUrl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/repos/cli/cli/releases", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_, _ = fmt.Fprint(w, `[{"tag_name": "v2.5.2"}]`)
+	}))
+	defer server.Close()
+
+	provider := &dockerized.GitHubVersionProvider{BaseUrl: "https://api.github.com", HttpClient: server.Client()}
+	versions, err := provider.ListVersions(context.Background(), dockerized.VersionRequest{
+		Name: "cli/cli",
+		Env:  dockerized.NewEnvironment([]string{"GITHUB_API_URL=" + server.URL + "/api/v3/", "GH_TOKEN=secret", "GITHUB_TOKEN=other"}),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v2.5.2"}, versions)
+}
+
+func TestRunListVersionsFromGitHub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/cli/cli/releases", r.URL.Path)
+		_, _ = fmt.Fprint(w, `[{"tag_name": "v2.5.2"}, {"tag_name": "v2.5.1"}, {"tag_name": "v2.4.0"}]`)
+	}))
+	defer server.Close()
+
+	_, output, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{Env: []string{"GITHUB_API_URL=" + server.URL}}, "gh:?")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "2.4.0\n2.5.1, 2.5.2\n", output)
+}
+
+func TestGoProxyVersionProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/github.com/!azure/azure-sdk-for-go/@v/list", r.URL.Path)
+		_, _ = fmt.Fprint(w, "v1.0.0\nv1.1.0\n")
+	}))
+	defer server.Close()
+
+	provider := &dockerized.GoProxyVersionProvider{BaseUrl: "https://proxy.invalid", HttpClient: server.Client()}
+	versions, err := provider.ListVersions(context.Background(), dockerized.VersionRequest{
+		Name: "github.com/Azure/azure-sdk-for-go",
+		Env:  dockerized.NewEnvironment([]string{"GOPROXY=" + server.URL + ",direct"}),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+}
+
+type staticVersionProvider []string
+
+func (p staticVersionProvider) ListVersions(context.Context, dockerized.VersionRequest) ([]string, error) {
+	return p, nil
+}
+
+func TestRunListVersionsFromCustomSource(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := "services:\n  app:\n    build: .\n    x-dockerized:\n      versions:\n        source: custom\n        name: app\n"
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+
+	_, output, err, exitCode := runFake(t, t.TempDir(), dockerized.Config{
+		Env: []string{"COMPOSE_FILE=" + composeFile},
+		VersionProviders: dockerized.VersionProviders{
+			"custom": staticVersionProvider{"v1.0.0", "v1.0.1", "v2.0.0", "nightly"},
+		},
+	}, "app:?")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "1.0.0, 1.0.1\n2.0.0\n", output)
+}
+
+// newListVersionsProject writes a project with an app, of which the versions are listed, and returns the project
+// directory and the Config to run it with runFake.
+func newListVersionsProject(t *testing.T) (string, dockerized.Config) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	compose := "services:\n  app:\n    image: \"app:${APP_VERSION}\"\n    x-dockerized:\n      versions:\n        source: custom\n        name: app\n"
+	assert.Nil(t, os.WriteFile(composeFile, []byte(compose), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "dockerized.env"), []byte("# app\nAPP_VERSION=1.0.1\n"), 0644))
+	return dir, dockerized.Config{
+		Env: []string{"COMPOSE_FILE=" + composeFile},
+		VersionProviders: dockerized.VersionProviders{
+			"custom": staticVersionProvider{"v1.0.0", "v1.0.1", "v1.1.0", "v2.0.0", "nightly"},
+		},
+	}
+}
+
+func TestRunListVersionsAsJson(t *testing.T) {
+	dir, config := newListVersionsProject(t)
+	_, output, err, exitCode := runFake(t, dir, config, "--output", "json", "app:?")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+
+	var listing dockerized.VersionListing
+	assert.Nil(t, json.Unmarshal([]byte(output), &listing))
+	assert.Equal(t, "app", listing.Command)
+	assert.Equal(t, "2.0.0", listing.Latest)
+	assert.Equal(t, []string{"1.0.0", "1.0.1", "1.1.0", "2.0.0"}, listing.Versions)
+	assert.Equal(t, []dockerized.VersionGroup{
+		{Minor: "1.0", Versions: []string{"1.0.0", "1.0.1"}},
+		{Minor: "1.1", Versions: []string{"1.1.0"}},
+		{Minor: "2.0", Versions: []string{"2.0.0"}},
+	}, listing.Groups)
+	assert.Equal(t, []string{"nightly", "v1.0.0", "v1.0.1", "v1.1.0", "v2.0.0"}, listing.RawVersions)
+	assert.NotNil(t, listing.Current)
+	assert.Equal(t, "APP_VERSION", listing.Current.Variable)
+	assert.Equal(t, "1.0.1", listing.Current.Version)
+	assert.Equal(t, "dockerized.env", filepath.Base(listing.Current.Source))
+	assert.Equal(t, 2, listing.Current.Line)
+}
+
+func TestRunListVersionsAsJsonVerbose(t *testing.T) {
+	dir, config := newListVersionsProject(t)
+	var stdout bytes.Buffer
+	config.Stdout = &stdout
+	_, stderr, err, _ := runFake(t, dir, config, "--verbose", "--output", "json", "app:?")
+	assert.Nil(t, err)
+
+	var listing dockerized.VersionListing
+	assert.Nil(t, json.Unmarshal(stdout.Bytes(), &listing))
+	assert.Equal(t, "2.0.0", listing.Latest)
+	assert.Contains(t, stderr, "Compose files: ")
+	assert.Contains(t, stderr, "Timings:")
+}
+
+func TestRunListVersionsAsYaml(t *testing.T) {
+	dir, config := newListVersionsProject(t)
+	_, output, err, _ := runFake(t, dir, config, "--output", "yaml", "--limit", "2", "app:?")
+	assert.Nil(t, err)
+	assert.Contains(t, output, "latest: 2.0.0\n")
+	assert.Contains(t, output, "versions:\n- 1.1.0\n- 2.0.0\n")
+}
+
+func TestRunListVersionsLimit(t *testing.T) {
+	dir, config := newListVersionsProject(t)
+	_, output, err, _ := runFake(t, dir, config, "--limit", "3", "app:?")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1\n1.1.0\n2.0.0\n", output)
+
+	_, output, err, _ = runFake(t, dir, config, "--latest", "app:?")
+	assert.Nil(t, err)
+	assert.Equal(t, "2.0.0\n", output)
+}
+
+func TestRunListVersionsInvalidOptions(t *testing.T) {
+	dir, config := newListVersionsProject(t)
+	for _, args := range [][]string{
+		{"--output", "xml", "app:?"},
+		{"--limit", "0", "app:?"},
+		{"--limit", "many", "app:?"},
+		{"--latest", "app"},
+	} {
+		_, _, err, exitCode := runFake(t, dir, config, args...)
+		assert.IsType(t, &dockerized.UsageError{}, err, args)
+		assert.Equal(t, dockerized.ExitCodeUsage, exitCode, args)
+	}
+}